@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"subscription-service/internal/models"
+	"subscription-service/internal/service"
+	"subscription-service/internal/tenant"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const apiKeyUsage = `usage:
+  server apikey issue [-tenant TENANT] -name NAME -scopes SCOPE[,SCOPE...] [-expires DURATION]
+  server apikey list [-tenant TENANT]
+  server apikey revoke [-tenant TENANT] ID`
+
+// runAPIKeyCommand issues, lists and revokes the API keys of a tenant from
+// the command line, for bootstrapping the first admin key of each tenant and
+// for operators without a token.
+func runAPIKeyCommand(ctx context.Context, keys service.APIKeyService, args []string) error {
+	if len(args) == 0 {
+		return errors.New(apiKeyUsage)
+	}
+
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	tenantID := flags.String("tenant", tenant.Default, "tenant the keys belong to")
+
+	switch args[0] {
+	case "issue":
+		name := flags.String("name", "", "name of the caller the key is for")
+		scopes := flags.String("scopes", "", "comma separated scopes")
+		expires := flags.Duration("expires", 0, "lifetime of the key, e.g. 720h; keys never expire by default")
+		ctx, err := parseTenantFlags(ctx, flags, args[1:], tenantID)
+		if err != nil {
+			return err
+		}
+
+		req := &models.IssueAPIKeyRequest{Name: *name}
+		for _, scope := range strings.Split(*scopes, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				req.Scopes = append(req.Scopes, scope)
+			}
+		}
+		if *expires > 0 {
+			expiresAt := time.Now().Add(*expires)
+			req.ExpiresAt = &expiresAt
+		}
+		if err := binding.Validator.ValidateStruct(req); err != nil {
+			return err
+		}
+
+		key, err := keys.IssueKey(ctx, req)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("id:     %s\ntenant: %s\nscopes: %s\nkey:    %s\n", key.ID, key.TenantID, strings.Join(key.Scopes, ","), key.Key)
+		fmt.Fprintln(os.Stderr, "Store the key now; it cannot be shown again.")
+		return nil
+
+	case "list":
+		ctx, err := parseTenantFlags(ctx, flags, args[1:], tenantID)
+		if err != nil {
+			return err
+		}
+
+		list, err := keys.ListKeys(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tEXPIRES\tLAST USED\tREVOKED")
+		for _, key := range list {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, key.Prefix, strings.Join(key.Scopes, ","),
+				formatTime(key.ExpiresAt), formatTime(key.LastUsedAt), formatTime(key.RevokedAt))
+		}
+		return w.Flush()
+
+	case "revoke":
+		ctx, err := parseTenantFlags(ctx, flags, args[1:], tenantID)
+		if err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return errors.New(apiKeyUsage)
+		}
+		id, err := uuid.Parse(flags.Arg(0))
+		if err != nil {
+			return errors.Wrap(err, "invalid api key id")
+		}
+		if err := keys.RevokeKey(ctx, id); err != nil {
+			return err
+		}
+		fmt.Printf("revoked %s\n", id)
+		return nil
+
+	default:
+		return errors.New(apiKeyUsage)
+	}
+}
+
+// parseTenantFlags parses args into flags and returns ctx bound to the tenant
+// of the tenant flag.
+func parseTenantFlags(ctx context.Context, flags *flag.FlagSet, args []string, tenantID *string) (context.Context, error) {
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if !tenant.Valid(*tenantID) {
+		return nil, errors.Errorf("invalid tenant id %q", *tenantID)
+	}
+	return tenant.WithID(ctx, *tenantID), nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
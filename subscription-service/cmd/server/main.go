@@ -9,8 +9,11 @@ import (
 	"syscall"
 	"time"
 
+	"subscription-service/internal/auth"
 	"subscription-service/internal/config"
 	"subscription-service/internal/handlers"
+	"subscription-service/internal/middleware"
+	"subscription-service/internal/models"
 	"subscription-service/internal/repository"
 	"subscription-service/internal/service"
 	"subscription-service/pkg/database"
@@ -18,6 +21,7 @@ import (
 	_ "subscription-service/docs"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
@@ -32,6 +36,10 @@ import (
 // @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
+
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
 func main() {
 	cfg, err := config.Load()
 	if err != nil {
@@ -45,38 +53,223 @@ func main() {
 		cfg.Database.Password,
 		cfg.Database.Name,
 		cfg.Database.SSLMode,
+		repository.NewConnector,
 	)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer db.Close()
 
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+
+	if len(os.Args) > 1 {
+		if os.Args[1] != "apikey" {
+			log.Fatalf("Unknown command %q", os.Args[1])
+		}
+		if err := runAPIKeyCommand(context.Background(), apiKeyService, os.Args[2:]); err != nil {
+			log.Fatalf("apikey: %v", err)
+		}
+		return
+	}
+
+	// The background jobs work across tenants, so they connect as a role
+	// that bypasses row-level security and get services of their own.
+	jobsDB, err := database.NewConnection(
+		cfg.Database.Host,
+		cfg.Database.Port,
+		cfg.Database.JobsUser,
+		cfg.Database.JobsPassword,
+		cfg.Database.Name,
+		cfg.Database.SSLMode,
+		repository.NewConnector,
+	)
+	if err != nil {
+		log.Fatalf("Failed to connect to database for jobs: %v", err)
+	}
+	defer jobsDB.Close()
+
 	subscriptionRepo := repository.NewSubscriptionRepository(db)
-	subscriptionService := service.NewSubscriptionService(subscriptionRepo)
+	serviceRepo := repository.NewServiceRepository(db)
+	userRepo := repository.NewUserRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	idempotencyRepo := repository.NewIdempotencyRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+	transactor := repository.NewTransactor(db)
+
+	webhookClient := service.NewWebhookClient(cfg.Webhooks.Timeout)
+	webhookRetry := models.WebhookRetryPolicy{
+		MaxAttempts: cfg.Webhooks.MaxAttempts,
+		Base:        cfg.Webhooks.RetryBase,
+		Max:         cfg.Webhooks.RetryMax,
+	}
+	webhookService := service.NewWebhookService(webhookRepo, subscriptionRepo, webhookClient, webhookRetry, cfg.Webhooks.RenewalNotice)
+	webhookHandler := handlers.NewWebhookHandler(webhookService)
+	webhookJobs := service.NewWebhookService(repository.NewWebhookRepository(jobsDB), repository.NewSubscriptionRepository(jobsDB),
+		webhookClient, webhookRetry, cfg.Webhooks.RenewalNotice)
+
+	sinks, err := outboxSinks(cfg, webhookJobs)
+	if err != nil {
+		log.Fatalf("Failed to set up outbox sinks: %v", err)
+	}
+	outboxDispatcher := service.NewOutboxDispatcher(repository.NewOutboxRepository(jobsDB), sinks)
+	// Event streams follow the outbox whatever sinks are configured and
+	// whichever instance dispatches the events.
+	eventBroker := service.NewEventBroker(cfg.Events.History)
+	outboxTail := service.NewOutboxTail(repository.NewOutboxRepository(jobsDB), eventBroker, cfg.Events.History)
+	eventHandler := handlers.NewEventHandler(eventBroker, cfg.Events.Heartbeat)
+
+	subscriptionService := service.NewSubscriptionService(subscriptionRepo, serviceRepo, userRepo, auditRepo, idempotencyRepo, outboxRepo, transactor,
+		cfg.Currency.Default, cfg.Idempotency.Window)
 	subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionService)
+	subscriptionJobs := service.NewSubscriptionService(
+		repository.NewSubscriptionRepository(jobsDB),
+		repository.NewServiceRepository(jobsDB),
+		repository.NewUserRepository(jobsDB),
+		repository.NewAuditRepository(jobsDB),
+		repository.NewIdempotencyRepository(jobsDB),
+		repository.NewOutboxRepository(jobsDB),
+		repository.NewTransactor(jobsDB),
+		cfg.Currency.Default, cfg.Idempotency.Window)
+
+	auditService := service.NewAuditService(auditRepo)
+	auditHandler := handlers.NewAuditHandler(auditService)
+
+	var reassignTo *uuid.UUID
+	if cfg.Users.ReassignTo != "" {
+		id, err := uuid.Parse(cfg.Users.ReassignTo)
+		if err != nil {
+			log.Fatalf("Invalid user to reassign subscriptions to: %v", err)
+		}
+		reassignTo = &id
+	}
+	userService := service.NewUserService(userRepo, subscriptionRepo, auditRepo, outboxRepo, transactor, models.UserDeletePolicy(cfg.Users.DeletePolicy), reassignTo)
+	userHandler := handlers.NewUserHandler(userService, subscriptionService)
+
+	catalogService := service.NewCatalogService(serviceRepo, auditRepo, outboxRepo, transactor)
+	serviceHandler := handlers.NewServiceHandler(catalogService)
+
+	exchangeRateRepo := repository.NewExchangeRateRepository(db)
+	exchangeRateService := service.NewExchangeRateService(exchangeRateRepo, transactor)
+	exchangeRateHandler := handlers.NewExchangeRateHandler(exchangeRateService)
+
+	if cfg.Currency.RatesFile != "" {
+		loaded, err := exchangeRateService.LoadFile(context.Background(), cfg.Currency.RatesFile)
+		if err != nil {
+			log.Fatalf("Failed to load exchange rates: %v", err)
+		}
+		log.Printf("Loaded %d exchange rates from %s", loaded, cfg.Currency.RatesFile)
+	}
 
 	router := gin.Default()
+	router.Use(middleware.RequestID())
 
 	// Swagger
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// Calendar apps cannot authenticate, so the charges feed is protected by
+	// the calendar token of its user instead and stays outside the group.
+	router.GET("/api/v1/users/:id/charges.ics", userHandler.GetChargesCalendar)
+
 	v1 := router.Group("/api/v1")
+	if cfg.Auth.Enabled {
+		// Without any JWT keys configured only API keys are accepted.
+		var verifier *auth.Verifier
+		if cfg.Auth.HMACSecret != "" || cfg.Auth.PublicKeyFile != "" || cfg.Auth.JWKSFile != "" {
+			verifier, err = auth.NewVerifier(auth.VerifierConfig{
+				HMACSecret:    cfg.Auth.HMACSecret,
+				PublicKeyFile: cfg.Auth.PublicKeyFile,
+				JWKSFile:      cfg.Auth.JWKSFile,
+				Issuer:        cfg.Auth.Issuer,
+				Audience:      cfg.Auth.Audience,
+				AdminRole:     cfg.Auth.AdminRole,
+			})
+			if err != nil {
+				log.Fatalf("Failed to set up authentication: %v", err)
+			}
+		}
+		v1.Use(middleware.Auth(verifier, apiKeyService))
+	}
+	v1.Use(middleware.Tenant(cfg.Tenancy.Header))
 	{
 		subscriptions := v1.Group("/subscriptions")
 		{
-			subscriptions.POST("", subscriptionHandler.CreateSubscription)
-			subscriptions.GET("", subscriptionHandler.ListSubscriptions)
-			subscriptions.GET("/total-cost", subscriptionHandler.GetTotalCost)
-			subscriptions.GET("/:id", subscriptionHandler.GetSubscription)
-			subscriptions.PUT("/:id", subscriptionHandler.UpdateSubscription)
-			subscriptions.DELETE("/:id", subscriptionHandler.DeleteSubscription)
+			subscriptions.POST("", middleware.Authorize(auth.OpSubscriptionsCreate), subscriptionHandler.CreateSubscription)
+			subscriptions.GET("", middleware.Authorize(auth.OpSubscriptionsList), subscriptionHandler.ListSubscriptions)
+			subscriptions.GET("/export", middleware.Authorize(auth.OpSubscriptionsExport), subscriptionHandler.ExportSubscriptions)
+			subscriptions.POST("/batch", middleware.Authorize(auth.OpSubscriptionsBatch), subscriptionHandler.ExecuteBatch)
+			subscriptions.POST("/import", middleware.Authorize(auth.OpSubscriptionsImport), subscriptionHandler.ImportSubscriptions)
+			subscriptions.GET("/total-cost", middleware.Authorize(auth.OpReportsTotalCost), subscriptionHandler.GetTotalCost)
+			subscriptions.GET("/total-cost/breakdown", middleware.Authorize(auth.OpReportsTotalCost), subscriptionHandler.GetCostBreakdown)
+			subscriptions.GET("/total-cost/by-service", middleware.Authorize(auth.OpReportsTotalCost), subscriptionHandler.GetCostByService)
+			subscriptions.GET("/:id", middleware.Authorize(auth.OpSubscriptionsGet), subscriptionHandler.GetSubscription)
+			subscriptions.GET("/:id/history", middleware.Authorize(auth.OpSubscriptionsHistory), subscriptionHandler.GetPriceHistory)
+			subscriptions.PUT("/:id", middleware.Authorize(auth.OpSubscriptionsUpdate), subscriptionHandler.UpdateSubscription)
+			subscriptions.DELETE("/:id", middleware.Authorize(auth.OpSubscriptionsDelete), subscriptionHandler.DeleteSubscription)
+			subscriptions.POST("/:id/pause", middleware.Authorize(auth.OpSubscriptionsLifecycle), subscriptionHandler.PauseSubscription)
+			subscriptions.POST("/:id/resume", middleware.Authorize(auth.OpSubscriptionsLifecycle), subscriptionHandler.ResumeSubscription)
+			subscriptions.POST("/:id/cancel", middleware.Authorize(auth.OpSubscriptionsLifecycle), subscriptionHandler.CancelSubscription)
+			subscriptions.POST("/:id/restore", middleware.Authorize(auth.OpSubscriptionsRestore), subscriptionHandler.RestoreSubscription)
+		}
+
+		users := v1.Group("/users")
+		{
+			users.POST("", middleware.Authorize(auth.OpUsersWrite), userHandler.CreateUser)
+			users.GET("", middleware.Authorize(auth.OpUsersRead), userHandler.ListUsers)
+			users.GET("/:id", middleware.Authorize(auth.OpUsersRead), userHandler.GetUser)
+			users.GET("/:id/subscriptions", middleware.Authorize(auth.OpSubscriptionsList), userHandler.ListUserSubscriptions)
+			users.PUT("/:id", middleware.Authorize(auth.OpUsersWrite), userHandler.UpdateUser)
+			users.DELETE("/:id", middleware.Authorize(auth.OpUsersWrite), userHandler.DeleteUser)
+			users.POST("/:id/calendar-token", middleware.Authorize(auth.OpCalendarTokensManage), userHandler.IssueCalendarToken)
+			users.DELETE("/:id/calendar-token", middleware.Authorize(auth.OpCalendarTokensManage), userHandler.RevokeCalendarToken)
 		}
+
+		services := v1.Group("/services")
+		{
+			services.POST("", middleware.Authorize(auth.OpCatalogWrite), serviceHandler.CreateService)
+			services.GET("", middleware.Authorize(auth.OpCatalogRead), serviceHandler.ListServices)
+			services.GET("/:id", middleware.Authorize(auth.OpCatalogRead), serviceHandler.GetService)
+			services.PUT("/:id", middleware.Authorize(auth.OpCatalogWrite), serviceHandler.UpdateService)
+			services.DELETE("/:id", middleware.Authorize(auth.OpCatalogWrite), serviceHandler.DeleteService)
+		}
+
+		apiKeys := v1.Group("/api-keys")
+		{
+			apiKeys.POST("", middleware.Authorize(auth.OpAPIKeysManage), apiKeyHandler.IssueAPIKey)
+			apiKeys.GET("", middleware.Authorize(auth.OpAPIKeysManage), apiKeyHandler.ListAPIKeys)
+			apiKeys.DELETE("/:id", middleware.Authorize(auth.OpAPIKeysManage), apiKeyHandler.RevokeAPIKey)
+		}
+
+		exchangeRates := v1.Group("/exchange-rates")
+		{
+			exchangeRates.GET("", middleware.Authorize(auth.OpCatalogRead), exchangeRateHandler.ListExchangeRates)
+			exchangeRates.PUT("", middleware.Authorize(auth.OpExchangeRatesWrite), exchangeRateHandler.SetExchangeRates)
+		}
+
+		webhooks := v1.Group("/webhooks")
+		{
+			webhooks.POST("", middleware.Authorize(auth.OpWebhooksManage), webhookHandler.CreateWebhookEndpoint)
+			webhooks.GET("", middleware.Authorize(auth.OpWebhooksManage), webhookHandler.ListWebhookEndpoints)
+			webhooks.GET("/:id", middleware.Authorize(auth.OpWebhooksManage), webhookHandler.GetWebhookEndpoint)
+			webhooks.PUT("/:id", middleware.Authorize(auth.OpWebhooksManage), webhookHandler.UpdateWebhookEndpoint)
+			webhooks.DELETE("/:id", middleware.Authorize(auth.OpWebhooksManage), webhookHandler.DeleteWebhookEndpoint)
+			webhooks.GET("/:id/deliveries", middleware.Authorize(auth.OpWebhooksManage), webhookHandler.ListWebhookDeliveries)
+			webhooks.POST("/:id/deliveries/:delivery_id/redeliver", middleware.Authorize(auth.OpWebhooksManage), webhookHandler.RedeliverWebhook)
+		}
+
+		v1.GET("/audit", middleware.Authorize(auth.OpAuditRead), auditHandler.ListAuditEntries)
+		v1.GET("/events", middleware.Authorize(auth.OpEventsStream), eventHandler.StreamEvents)
 	}
 
 	srv := &http.Server{
 		Addr:    ":" + cfg.Server.Port,
 		Handler: router,
 	}
+	// Event streams never end on their own, so they are closed for the
+	// shutdown not to wait for them.
+	srv.RegisterOnShutdown(eventBroker.Close)
 
 	go func() {
 		log.Printf("Server starting on port %s", cfg.Server.Port)
@@ -85,11 +278,19 @@ func main() {
 		}
 	}()
 
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go runPurge(jobs, subscriptionJobs, cfg.Retention.DeletedSubscriptions, cfg.Retention.PurgeInterval)
+	go runOutbox(jobs, outboxDispatcher, cfg.Outbox.PollInterval, cfg.Outbox.Retention)
+	go runOutboxTail(jobs, outboxTail, cfg.Outbox.PollInterval)
+	go runWebhooks(jobs, webhookJobs, cfg.Webhooks.PollInterval, cfg.Webhooks.RenewalInterval)
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopJobs()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"subscription-service/internal/config"
+	"subscription-service/internal/service"
+	"time"
+)
+
+// outboxSinks creates the configured sinks of the outbox.
+func outboxSinks(cfg *config.Config, webhooks service.WebhookService) ([]service.Sink, error) {
+	var sinks []service.Sink
+	for _, name := range cfg.Outbox.Sinks {
+		switch name {
+		case "webhooks":
+			sinks = append(sinks, service.NewWebhookSink(webhooks))
+		case "log":
+			sinks = append(sinks, service.NewLogSink())
+		case "file":
+			sink, err := service.NewFileSink(cfg.Outbox.File)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case "http":
+			sinks = append(sinks, service.NewHTTPSink(&http.Client{Timeout: cfg.Webhooks.Timeout}, cfg.Outbox.URL))
+		}
+	}
+	return sinks, nil
+}
+
+// runOutbox dispatches the events in the outbox every pollInterval and
+// purges those sent longer than retention ago every hour until ctx is
+// cancelled.
+func runOutbox(ctx context.Context, outbox service.OutboxDispatcher, pollInterval, retention time.Duration) {
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	purge := time.NewTicker(time.Hour)
+	defer purge.Stop()
+
+	for {
+		// Events are dispatched until none is due anymore.
+		for {
+			dispatched, err := outbox.DispatchDue(ctx)
+			if err != nil {
+				log.Printf("Failed to dispatch outbox events: %v", err)
+			}
+			if err != nil || dispatched == 0 || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-purge.C:
+			purged, err := outbox.PurgeSent(ctx, retention)
+			if err != nil {
+				log.Printf("Failed to purge sent outbox events: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d sent outbox events", purged)
+			}
+		case <-poll.C:
+		}
+	}
+}
+
+// runOutboxTail follows the outbox every pollInterval until ctx is
+// cancelled.
+func runOutboxTail(ctx context.Context, tail service.OutboxTail, pollInterval time.Duration) {
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+
+	for {
+		if _, err := tail.Poll(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to follow outbox events: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+		}
+	}
+}
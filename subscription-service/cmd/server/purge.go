@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"log"
+	"subscription-service/internal/service"
+	"time"
+)
+
+// runPurge purges expired idempotency keys and, unless retention is zero,
+// deleted subscriptions older than retention every interval until ctx is
+// cancelled.
+func runPurge(ctx context.Context, subscriptions service.SubscriptionService, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if retention > 0 {
+			purged, err := subscriptions.PurgeDeleted(ctx, retention)
+			if err != nil {
+				log.Printf("Failed to purge deleted subscriptions: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d deleted subscriptions", purged)
+			}
+		}
+
+		expired, err := subscriptions.PurgeExpiredKeys(ctx)
+		if err != nil {
+			log.Printf("Failed to purge expired idempotency keys: %v", err)
+		} else if expired > 0 {
+			log.Printf("Purged %d expired idempotency keys", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
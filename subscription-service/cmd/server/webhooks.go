@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"log"
+	"subscription-service/internal/service"
+	"time"
+)
+
+// runWebhooks attempts due webhook deliveries every pollInterval and looks
+// for charges to announce every renewalInterval until ctx is cancelled.
+func runWebhooks(ctx context.Context, webhooks service.WebhookService, pollInterval, renewalInterval time.Duration) {
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	renewals := time.NewTicker(renewalInterval)
+	defer renewals.Stop()
+
+	publishRenewals(ctx, webhooks)
+	for {
+		// Attempts are made until no delivery is due anymore.
+		for {
+			attempted, err := webhooks.DeliverDue(ctx)
+			if err != nil {
+				log.Printf("Failed to deliver webhooks: %v", err)
+			}
+			if err != nil || attempted == 0 || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-renewals.C:
+			publishRenewals(ctx, webhooks)
+		case <-poll.C:
+		}
+	}
+}
+
+func publishRenewals(ctx context.Context, webhooks service.WebhookService) {
+	scheduled, err := webhooks.PublishRenewals(ctx)
+	if err != nil {
+		log.Printf("Failed to publish renewal notices: %v", err)
+	} else if scheduled > 0 {
+		log.Printf("Scheduled %d renewal notices", scheduled)
+	}
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Principal is the authenticated caller of a request: a user authenticated
+// with a JWT or a service authenticated with an API key. APIKeyID is only set
+// for the latter, which have no user and are limited by their Scopes instead.
+// API keys and users whose token names a tenant are bound to it through
+// TenantID.
+type Principal struct {
+	UserID   uuid.UUID
+	Roles    []string
+	Admin    bool
+	APIKeyID *uuid.UUID
+	Scopes   []string
+	TenantID string
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal carried by ctx. Requests served without
+// authentication carry none.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// Restricted returns the principal of ctx when it may only access its own
+// data, i.e. when the request is authenticated as a member.
+func Restricted(ctx context.Context) (*Principal, bool) {
+	p, ok := FromContext(ctx)
+	if !ok || p.seesAll() {
+		return nil, false
+	}
+	return p, true
+}
+
+// Actor names the caller of ctx in records of its changes: user:<id> or
+// api_key:<id>, or anonymous for requests served without authentication.
+func Actor(ctx context.Context) string {
+	p, ok := FromContext(ctx)
+	switch {
+	case !ok:
+		return "anonymous"
+	case p.APIKeyID != nil:
+		return "api_key:" + p.APIKeyID.String()
+	default:
+		return "user:" + p.UserID.String()
+	}
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// VerifierConfig lists the keys tokens may be signed with. HMACSecret
+// verifies HS256 tokens, PublicKeyFile (PEM) and the RSA keys of JWKSFile
+// verify RS256 tokens. Symmetric keys of JWKSFile verify HS256 tokens.
+// Tokens carrying AdminRole in their roles claim are admins.
+type VerifierConfig struct {
+	HMACSecret    string
+	PublicKeyFile string
+	JWKSFile      string
+	Issuer        string
+	Audience      string
+	AdminRole     string
+}
+
+// Verifier validates JWTs and turns them into principals.
+type Verifier struct {
+	hmacKeys  map[string][]byte
+	rsaKeys   map[string]*rsa.PublicKey
+	parser    *jwt.Parser
+	adminRole string
+}
+
+type claims struct {
+	jwt.RegisteredClaims
+	Roles  []string `json:"roles"`
+	Tenant string   `json:"tenant"`
+}
+
+// NewVerifier loads the configured keys. Keys without an id are used for
+// tokens without a kid header.
+func NewVerifier(cfg VerifierConfig) (*Verifier, error) {
+	v := &Verifier{
+		hmacKeys:  map[string][]byte{},
+		rsaKeys:   map[string]*rsa.PublicKey{},
+		adminRole: cfg.AdminRole,
+	}
+
+	if cfg.HMACSecret != "" {
+		v.hmacKeys[""] = []byte(cfg.HMACSecret)
+	}
+
+	if cfg.PublicKeyFile != "" {
+		data, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read public key file")
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse public key file")
+		}
+		v.rsaKeys[""] = key
+	}
+
+	if cfg.JWKSFile != "" {
+		if err := v.loadJWKS(cfg.JWKSFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(v.hmacKeys) == 0 && len(v.rsaKeys) == 0 {
+		return nil, errors.New("no keys configured to verify tokens with")
+	}
+
+	opts := []jwt.ParserOption{jwt.WithValidMethods([]string{"HS256", "RS256"}), jwt.WithExpirationRequired()}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+
+	return v, nil
+}
+
+// Verify validates a token and returns its principal. The subject claim is
+// the id of the user the token was issued to, the tenant claim binds the
+// user to a tenant.
+func (v *Verifier) Verify(token string) (*Principal, error) {
+	var c claims
+	if _, err := v.parser.ParseWithClaims(token, &c, v.key); err != nil {
+		return nil, errors.Wrap(ErrInvalidToken, err.Error())
+	}
+
+	userID, err := uuid.Parse(c.Subject)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidToken, "subject is not a user id")
+	}
+
+	p := &Principal{UserID: userID, Roles: c.Roles, TenantID: c.Tenant}
+	for _, role := range c.Roles {
+		if role == v.adminRole {
+			p.Admin = true
+		}
+	}
+
+	return p, nil
+}
+
+// key picks the key a token was signed with by its algorithm and kid.
+func (v *Verifier) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	switch token.Method.Alg() {
+	case "HS256":
+		if key, ok := v.hmacKeys[kid]; ok {
+			return key, nil
+		}
+	case "RS256":
+		if key, ok := v.rsaKeys[kid]; ok {
+			return key, nil
+		}
+	}
+
+	return nil, errors.Errorf("no %s key with id %q", token.Method.Alg(), kid)
+}
+
+// jwk is the subset of RFC 7517 keys supported: RSA public keys and
+// symmetric keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+func (v *Verifier) loadJWKS(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to read JWKS file")
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return errors.Wrap(err, "failed to parse JWKS file")
+	}
+
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		switch key.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(key.N)
+			if err != nil {
+				return errors.Wrapf(err, "invalid modulus of key %q", key.Kid)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(key.E)
+			if err != nil {
+				return errors.Wrapf(err, "invalid exponent of key %q", key.Kid)
+			}
+			v.rsaKeys[key.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "oct":
+			k, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil {
+				return errors.Wrapf(err, "invalid secret of key %q", key.Kid)
+			}
+			v.hmacKeys[key.Kid] = k
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"subscription-service/internal/models"
+)
+
+// Operation names what a handler does, independent of its route.
+type Operation string
+
+const (
+	OpSubscriptionsCreate    Operation = "subscriptions.create"
+	OpSubscriptionsList      Operation = "subscriptions.list"
+	OpSubscriptionsExport    Operation = "subscriptions.export"
+	OpSubscriptionsGet       Operation = "subscriptions.get"
+	OpSubscriptionsHistory   Operation = "subscriptions.history"
+	OpSubscriptionsUpdate    Operation = "subscriptions.update"
+	OpSubscriptionsDelete    Operation = "subscriptions.delete"
+	OpSubscriptionsLifecycle Operation = "subscriptions.lifecycle"
+	OpSubscriptionsRestore   Operation = "subscriptions.restore"
+	OpSubscriptionsBatch     Operation = "subscriptions.batch"
+	OpSubscriptionsImport    Operation = "subscriptions.import"
+	OpReportsTotalCost       Operation = "reports.total_cost"
+	OpUsersRead              Operation = "users.read"
+	OpUsersWrite             Operation = "users.write"
+	OpCalendarTokensManage   Operation = "calendar_tokens.manage"
+	OpCatalogRead            Operation = "catalog.read"
+	OpCatalogWrite           Operation = "catalog.write"
+	OpExchangeRatesWrite     Operation = "exchange_rates.write"
+	OpAPIKeysManage          Operation = "api_keys.manage"
+	OpAuditRead              Operation = "audit.read"
+	OpWebhooksManage         Operation = "webhooks.manage"
+	OpEventsStream           Operation = "events.stream"
+)
+
+// Role is a role users are granted through the roles claim of their token.
+// Users without any known role are members. The admin role is the one
+// configured as VerifierConfig.AdminRole and shows as Principal.Admin.
+type Role string
+
+const (
+	RoleAdmin    Role = "admin"
+	RoleSupport  Role = "support"
+	RoleMember   Role = "member"
+	RoleReadOnly Role = "read-only"
+)
+
+// Reasons of denials, returned to clients.
+const (
+	ReasonMissingRole      = "missing_role"
+	ReasonMissingScope     = "missing_scope"
+	ReasonUnknownOperation = "unknown_operation"
+	ReasonNotOwner         = "not_owner"
+	ReasonTenantMismatch   = "tenant_mismatch"
+	ReasonGlobalOperation  = "global_operation"
+)
+
+// rule lists who may perform an operation. Global operations affect all
+// tenants and are reserved to admins not bound to a tenant.
+type rule struct {
+	roles  []Role
+	scope  string
+	global bool
+}
+
+// policy lists the roles allowed to perform each operation and the scope
+// API keys need for it. Admins may perform every operation. Members only
+// see their own subscriptions, support staff and read-only users all of
+// them. Read-only users may only list subscriptions and report their total
+// cost.
+var policy = map[Operation]rule{
+	OpSubscriptionsCreate:    {roles: []Role{RoleMember}, scope: models.ScopeSubscriptionsWrite},
+	OpSubscriptionsList:      {roles: []Role{RoleSupport, RoleMember, RoleReadOnly}, scope: models.ScopeSubscriptionsRead},
+	OpSubscriptionsExport:    {roles: []Role{RoleSupport, RoleMember}, scope: models.ScopeSubscriptionsRead},
+	OpSubscriptionsGet:       {roles: []Role{RoleSupport, RoleMember}, scope: models.ScopeSubscriptionsRead},
+	OpSubscriptionsHistory:   {roles: []Role{RoleSupport, RoleMember}, scope: models.ScopeSubscriptionsRead},
+	OpSubscriptionsUpdate:    {roles: []Role{RoleSupport, RoleMember}, scope: models.ScopeSubscriptionsWrite},
+	OpSubscriptionsDelete:    {roles: []Role{RoleMember}, scope: models.ScopeSubscriptionsWrite},
+	OpSubscriptionsLifecycle: {roles: []Role{RoleSupport, RoleMember}, scope: models.ScopeSubscriptionsWrite},
+	OpSubscriptionsRestore:   {roles: []Role{RoleSupport}, scope: models.ScopeSubscriptionsWrite},
+	OpSubscriptionsBatch:     {roles: []Role{RoleSupport, RoleMember}, scope: models.ScopeSubscriptionsWrite},
+	OpSubscriptionsImport:    {roles: []Role{RoleMember}, scope: models.ScopeSubscriptionsWrite},
+	OpReportsTotalCost:       {roles: []Role{RoleSupport, RoleMember, RoleReadOnly}, scope: models.ScopeReportsRead},
+	OpUsersRead:              {roles: []Role{RoleSupport}, scope: models.ScopeUsersRead},
+	OpUsersWrite:             {scope: models.ScopeUsersWrite},
+	OpCalendarTokensManage:   {roles: []Role{RoleMember}, scope: models.ScopeUsersWrite},
+	OpCatalogRead:            {roles: []Role{RoleSupport, RoleMember}, scope: models.ScopeCatalogRead},
+	OpCatalogWrite:           {scope: models.ScopeCatalogWrite},
+	OpExchangeRatesWrite:     {global: true},
+	OpAPIKeysManage:          {scope: models.ScopeAdmin},
+	OpAuditRead:              {roles: []Role{RoleSupport}, scope: models.ScopeAuditRead},
+	OpWebhooksManage:         {scope: models.ScopeWebhooksManage},
+	OpEventsStream:           {roles: []Role{RoleSupport, RoleMember}, scope: models.ScopeSubscriptionsRead},
+}
+
+// Denial explains why a principal may not perform an operation.
+type Denial struct {
+	Operation Operation
+	Reason    string
+	Message   string
+}
+
+// Authorize checks p against the policy. It returns nil when p may perform
+// op. API keys are checked against the scope of the operation, users
+// against its roles. Global operations are only open to unbound admins.
+func Authorize(p *Principal, op Operation) *Denial {
+	rule, ok := policy[op]
+	if !ok {
+		return &Denial{Operation: op, Reason: ReasonUnknownOperation, Message: "operation is not covered by the access policy"}
+	}
+
+	if rule.global {
+		if !p.Admin || p.TenantID != "" {
+			return &Denial{Operation: op, Reason: ReasonGlobalOperation, Message: "only admins not bound to a tenant may perform " + string(op)}
+		}
+		return nil
+	}
+
+	if p.APIKeyID != nil {
+		for _, scope := range p.Scopes {
+			if scope == rule.scope {
+				return nil
+			}
+		}
+		return &Denial{Operation: op, Reason: ReasonMissingScope, Message: "api key lacks scope " + rule.scope}
+	}
+
+	if p.Admin {
+		return nil
+	}
+	for _, role := range p.roles() {
+		for _, allowed := range rule.roles {
+			if role == allowed {
+				return nil
+			}
+		}
+	}
+	return &Denial{Operation: op, Reason: ReasonMissingRole, Message: "no role of the caller allows " + string(op)}
+}
+
+// roles returns the known roles of p, defaulting to member.
+func (p *Principal) roles() []Role {
+	var roles []Role
+	for _, name := range p.Roles {
+		switch role := Role(name); role {
+		case RoleSupport, RoleMember, RoleReadOnly:
+			roles = append(roles, role)
+		}
+	}
+	if len(roles) == 0 {
+		roles = []Role{RoleMember}
+	}
+	return roles
+}
+
+// seesAll reports whether p may access the subscriptions of all users.
+func (p *Principal) seesAll() bool {
+	if p.Admin || p.APIKeyID != nil {
+		return true
+	}
+	for _, role := range p.roles() {
+		if role == RoleSupport || role == RoleReadOnly {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"gopkg.in/yaml.v3"
@@ -12,13 +16,94 @@ type Config struct {
 		Port string `yaml:"port" env:"SERVER_PORT"`
 	} `yaml:"server"`
 	Database struct {
-		Host     string `yaml:"host" env:"DB_HOST"`
-		Port     string `yaml:"port" env:"DB_PORT"`
-		User     string `yaml:"user" env:"DB_USER"`
-		Password string `yaml:"password" env:"DB_PASSWORD"`
-		Name     string `yaml:"name" env:"DB_NAME"`
-		SSLMode  string `yaml:"ssl_mode" env:"DB_SSL_MODE"`
+		Host string `yaml:"host" env:"DB_HOST"`
+		Port string `yaml:"port" env:"DB_PORT"`
+		// User serves requests and must be subject to row-level security,
+		// so neither a superuser, the owner of the tables nor a role with
+		// BYPASSRLS. JobsUser runs the background jobs, which work across
+		// tenants, and needs BYPASSRLS. Migration 020 creates both roles.
+		User         string `yaml:"user" env:"DB_USER"`
+		Password     string `yaml:"password" env:"DB_PASSWORD"`
+		JobsUser     string `yaml:"jobs_user" env:"DB_JOBS_USER"`
+		JobsPassword string `yaml:"jobs_password" env:"DB_JOBS_PASSWORD"`
+		Name         string `yaml:"name" env:"DB_NAME"`
+		SSLMode      string `yaml:"ssl_mode" env:"DB_SSL_MODE"`
 	} `yaml:"database"`
+	Currency struct {
+		Default   string `yaml:"default" env:"CURRENCY_DEFAULT"`
+		RatesFile string `yaml:"rates_file" env:"EXCHANGE_RATES_FILE"`
+	} `yaml:"currency"`
+	Users struct {
+		// DeletePolicy is reject, cascade or reassign; see
+		// models.UserDeletePolicy. ReassignTo is the user the subscriptions
+		// of deleted users are moved to under the reassign policy unless the
+		// request names another one.
+		DeletePolicy string `yaml:"delete_policy" env:"USER_DELETE_POLICY"`
+		ReassignTo   string `yaml:"reassign_to" env:"USER_REASSIGN_TO"`
+	} `yaml:"users"`
+	Auth struct {
+		// Enabled requires a JWT bearer token on every API request. Tokens
+		// are verified with the HMAC secret, the RSA public key file and the
+		// keys of the JWKS file, whichever are set.
+		Enabled       bool   `yaml:"enabled" env:"AUTH_ENABLED"`
+		HMACSecret    string `yaml:"hmac_secret" env:"JWT_HMAC_SECRET"`
+		PublicKeyFile string `yaml:"public_key_file" env:"JWT_PUBLIC_KEY_FILE"`
+		JWKSFile      string `yaml:"jwks_file" env:"JWT_JWKS_FILE"`
+		Issuer        string `yaml:"issuer" env:"JWT_ISSUER"`
+		Audience      string `yaml:"audience" env:"JWT_AUDIENCE"`
+		AdminRole     string `yaml:"admin_role" env:"JWT_ADMIN_ROLE"`
+	} `yaml:"auth"`
+	Retention struct {
+		// DeletedSubscriptions is how long deleted subscriptions can be
+		// restored before they are purged; zero keeps them forever. Purges,
+		// which also remove expired idempotency keys, run every
+		// PurgeInterval.
+		DeletedSubscriptions time.Duration `yaml:"deleted_subscriptions" env:"RETENTION_DELETED_SUBSCRIPTIONS"`
+		PurgeInterval        time.Duration `yaml:"purge_interval" env:"RETENTION_PURGE_INTERVAL"`
+	} `yaml:"retention"`
+	Idempotency struct {
+		// Window is how long idempotency keys of subscription creations
+		// are remembered.
+		Window time.Duration `yaml:"window" env:"IDEMPOTENCY_WINDOW"`
+	} `yaml:"idempotency"`
+	Webhooks struct {
+		// Due deliveries are attempted every PollInterval, each attempt
+		// limited to Timeout. Failed attempts are retried after RetryBase,
+		// doubling up to RetryMax, until MaxAttempts attempts failed.
+		// Renewal notices go out RenewalNotice ahead of charges and are
+		// looked for every RenewalInterval.
+		PollInterval    time.Duration `yaml:"poll_interval" env:"WEBHOOK_POLL_INTERVAL"`
+		Timeout         time.Duration `yaml:"timeout" env:"WEBHOOK_TIMEOUT"`
+		MaxAttempts     int           `yaml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS"`
+		RetryBase       time.Duration `yaml:"retry_base" env:"WEBHOOK_RETRY_BASE"`
+		RetryMax        time.Duration `yaml:"retry_max" env:"WEBHOOK_RETRY_MAX"`
+		RenewalNotice   time.Duration `yaml:"renewal_notice" env:"WEBHOOK_RENEWAL_NOTICE"`
+		RenewalInterval time.Duration `yaml:"renewal_interval" env:"WEBHOOK_RENEWAL_INTERVAL"`
+	} `yaml:"webhooks"`
+	Outbox struct {
+		// Sinks lists where the events of changes go: webhooks, log, file
+		// and http. The file sink appends them to File as NDJSON, the http
+		// sink posts them to URL. The outbox is polled every PollInterval
+		// and sent events are kept for Retention.
+		Sinks        []string      `yaml:"sinks" env:"OUTBOX_SINKS"`
+		File         string        `yaml:"file" env:"OUTBOX_FILE"`
+		URL          string        `yaml:"url" env:"OUTBOX_URL"`
+		PollInterval time.Duration `yaml:"poll_interval" env:"OUTBOX_POLL_INTERVAL"`
+		Retention    time.Duration `yaml:"retention" env:"OUTBOX_RETENTION"`
+	} `yaml:"outbox"`
+	Events struct {
+		// History is the number of events retained for event streams that
+		// resume. Every instance follows the outbox every
+		// Outbox.PollInterval, starting with the last History events. Idle
+		// streams get a heartbeat every Heartbeat.
+		History   int           `yaml:"history" env:"EVENTS_HISTORY"`
+		Heartbeat time.Duration `yaml:"heartbeat" env:"EVENTS_HEARTBEAT"`
+	} `yaml:"events"`
+	Tenancy struct {
+		// Header names the tenant of requests. Users whose token carries a
+		// tenant claim are bound to that tenant whatever the header says.
+		Header string `yaml:"header" env:"TENANT_HEADER"`
+	} `yaml:"tenancy"`
 }
 
 func Load() (*Config, error) {
@@ -52,6 +137,12 @@ func Load() (*Config, error) {
 	if password := os.Getenv("DB_PASSWORD"); password != "" {
 		config.Database.Password = password
 	}
+	if user := os.Getenv("DB_JOBS_USER"); user != "" {
+		config.Database.JobsUser = user
+	}
+	if password := os.Getenv("DB_JOBS_PASSWORD"); password != "" {
+		config.Database.JobsPassword = password
+	}
 	if name := os.Getenv("DB_NAME"); name != "" {
 		config.Database.Name = name
 	}
@@ -59,5 +150,179 @@ func Load() (*Config, error) {
 		config.Database.SSLMode = sslMode
 	}
 
+	if currency := os.Getenv("CURRENCY_DEFAULT"); currency != "" {
+		config.Currency.Default = currency
+	}
+	if ratesFile := os.Getenv("EXCHANGE_RATES_FILE"); ratesFile != "" {
+		config.Currency.RatesFile = ratesFile
+	}
+
+	if policy := os.Getenv("USER_DELETE_POLICY"); policy != "" {
+		config.Users.DeletePolicy = policy
+	}
+	if reassignTo := os.Getenv("USER_REASSIGN_TO"); reassignTo != "" {
+		config.Users.ReassignTo = reassignTo
+	}
+
+	if enabled := os.Getenv("AUTH_ENABLED"); enabled != "" {
+		value, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AUTH_ENABLED: %w", err)
+		}
+		config.Auth.Enabled = value
+	}
+	if secret := os.Getenv("JWT_HMAC_SECRET"); secret != "" {
+		config.Auth.HMACSecret = secret
+	}
+	if keyFile := os.Getenv("JWT_PUBLIC_KEY_FILE"); keyFile != "" {
+		config.Auth.PublicKeyFile = keyFile
+	}
+	if jwksFile := os.Getenv("JWT_JWKS_FILE"); jwksFile != "" {
+		config.Auth.JWKSFile = jwksFile
+	}
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		config.Auth.Issuer = issuer
+	}
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		config.Auth.Audience = audience
+	}
+	if role := os.Getenv("JWT_ADMIN_ROLE"); role != "" {
+		config.Auth.AdminRole = role
+	}
+
+	durations := map[string]*time.Duration{
+		"RETENTION_DELETED_SUBSCRIPTIONS": &config.Retention.DeletedSubscriptions,
+		"RETENTION_PURGE_INTERVAL":        &config.Retention.PurgeInterval,
+		"IDEMPOTENCY_WINDOW":              &config.Idempotency.Window,
+		"WEBHOOK_POLL_INTERVAL":           &config.Webhooks.PollInterval,
+		"WEBHOOK_TIMEOUT":                 &config.Webhooks.Timeout,
+		"WEBHOOK_RETRY_BASE":              &config.Webhooks.RetryBase,
+		"WEBHOOK_RETRY_MAX":               &config.Webhooks.RetryMax,
+		"WEBHOOK_RENEWAL_NOTICE":          &config.Webhooks.RenewalNotice,
+		"WEBHOOK_RENEWAL_INTERVAL":        &config.Webhooks.RenewalInterval,
+		"OUTBOX_POLL_INTERVAL":            &config.Outbox.PollInterval,
+		"OUTBOX_RETENTION":                &config.Outbox.Retention,
+		"EVENTS_HEARTBEAT":                &config.Events.Heartbeat,
+	}
+	for name, target := range durations {
+		if value := os.Getenv(name); value != "" {
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*target = duration
+		}
+	}
+
+	if attempts := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); attempts != "" {
+		value, err := strconv.Atoi(attempts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS: %w", err)
+		}
+		config.Webhooks.MaxAttempts = value
+	}
+
+	if sinks := os.Getenv("OUTBOX_SINKS"); sinks != "" {
+		config.Outbox.Sinks = strings.Split(sinks, ",")
+		for i := range config.Outbox.Sinks {
+			config.Outbox.Sinks[i] = strings.TrimSpace(config.Outbox.Sinks[i])
+		}
+	}
+	if file := os.Getenv("OUTBOX_FILE"); file != "" {
+		config.Outbox.File = file
+	}
+	if url := os.Getenv("OUTBOX_URL"); url != "" {
+		config.Outbox.URL = url
+	}
+
+	if history := os.Getenv("EVENTS_HISTORY"); history != "" {
+		value, err := strconv.Atoi(history)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EVENTS_HISTORY: %w", err)
+		}
+		config.Events.History = value
+	}
+
+	if header := os.Getenv("TENANT_HEADER"); header != "" {
+		config.Tenancy.Header = header
+	}
+
+	if config.Currency.Default == "" {
+		config.Currency.Default = "RUB"
+	}
+	if config.Auth.AdminRole == "" {
+		config.Auth.AdminRole = "admin"
+	}
+	if config.Retention.PurgeInterval <= 0 {
+		config.Retention.PurgeInterval = time.Hour
+	}
+	if config.Idempotency.Window <= 0 {
+		config.Idempotency.Window = 24 * time.Hour
+	}
+	if config.Webhooks.PollInterval <= 0 {
+		config.Webhooks.PollInterval = 5 * time.Second
+	}
+	if config.Webhooks.Timeout <= 0 {
+		config.Webhooks.Timeout = 10 * time.Second
+	}
+	if config.Webhooks.MaxAttempts <= 0 {
+		config.Webhooks.MaxAttempts = 10
+	}
+	if config.Webhooks.RetryBase <= 0 {
+		config.Webhooks.RetryBase = 30 * time.Second
+	}
+	if config.Webhooks.RetryMax <= 0 {
+		config.Webhooks.RetryMax = 6 * time.Hour
+	}
+	if config.Webhooks.RenewalNotice <= 0 {
+		config.Webhooks.RenewalNotice = 72 * time.Hour
+	}
+	if config.Webhooks.RenewalInterval <= 0 {
+		config.Webhooks.RenewalInterval = time.Hour
+	}
+	if config.Outbox.Sinks == nil {
+		config.Outbox.Sinks = []string{"webhooks"}
+	}
+	if config.Outbox.PollInterval <= 0 {
+		config.Outbox.PollInterval = time.Second
+	}
+	if config.Outbox.Retention <= 0 {
+		config.Outbox.Retention = 7 * 24 * time.Hour
+	}
+	if config.Events.History <= 0 {
+		config.Events.History = 1000
+	}
+	if config.Events.Heartbeat <= 0 {
+		config.Events.Heartbeat = 15 * time.Second
+	}
+	if config.Tenancy.Header == "" {
+		config.Tenancy.Header = "X-Tenant-ID"
+	}
+	if config.Users.DeletePolicy == "" {
+		config.Users.DeletePolicy = "reject"
+	}
+
+	switch config.Users.DeletePolicy {
+	case "reject", "cascade", "reassign":
+	default:
+		return nil, fmt.Errorf("unknown user delete policy %q", config.Users.DeletePolicy)
+	}
+
+	for _, sink := range config.Outbox.Sinks {
+		switch sink {
+		case "webhooks", "log":
+		case "file":
+			if config.Outbox.File == "" {
+				return nil, fmt.Errorf("the file outbox sink needs a file")
+			}
+		case "http":
+			if config.Outbox.URL == "" {
+				return nil, fmt.Errorf("the http outbox sink needs a url")
+			}
+		default:
+			return nil, fmt.Errorf("unknown outbox sink %q", sink)
+		}
+	}
+
 	return config, nil
 }
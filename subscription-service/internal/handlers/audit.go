@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"subscription-service/internal/models"
+	"subscription-service/internal/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+type AuditHandler struct {
+	service service.AuditService
+}
+
+func NewAuditHandler(service service.AuditService) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+// ListAuditEntries godoc
+// @Summary List audit entries
+// @Description Get the recorded changes of subscriptions, newest first
+// @Tags audit
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param entity_id query string false "ID of the changed entity"
+// @Param actor query string false "Actor, user:<id>, api_key:<id> or anonymous"
+// @Param from query string false "Earliest time of the change (RFC 3339)"
+// @Param to query string false "Latest time of the change (RFC 3339)"
+// @Param limit query int false "Maximum number of entries (1-1000, default 100)"
+// @Success 200 {array} models.AuditEntry
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /audit [get]
+func (h *AuditHandler) ListAuditEntries(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := h.service.ListEntries(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+func parseAuditFilter(c *gin.Context) (*models.AuditFilter, error) {
+	filter := &models.AuditFilter{Actor: c.Query("actor")}
+
+	if value := c.Query("entity_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, errors.New("invalid entity id")
+		}
+		filter.EntityID = &id
+	}
+
+	times := map[string]**time.Time{
+		"from": &filter.From,
+		"to":   &filter.To,
+	}
+	for name, target := range times {
+		if value := c.Query(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, errors.Errorf("%s must be an RFC 3339 time", name)
+			}
+			*target = &t
+		}
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > models.MaxAuditLimit {
+			return nil, errors.Errorf("limit must be between 1 and %d", models.MaxAuditLimit)
+		}
+		filter.Limit = value
+	}
+
+	return filter, nil
+}
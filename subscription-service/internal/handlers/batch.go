@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"subscription-service/internal/models"
+	"subscription-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// ExecuteBatch godoc
+// @Summary Create, update and delete subscriptions in a batch
+// @Description Apply up to 100 operations in order. Atomic batches (the default) apply all operations or none; best-effort batches apply every valid operation on its own. Results are reported by the index of their operation.
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param request body models.BatchRequest true "Batch operations"
+// @Success 200 {object} models.BatchResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 422 {object} models.BatchResponse
+// @Failure 500 {object} map[string]string
+// @Router /subscriptions/batch [post]
+func (h *SubscriptionHandler) ExecuteBatch(c *gin.Context) {
+	var req models.BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.service.ExecuteBatch(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, result := range response.Results {
+		switch result.Status {
+		case models.BatchItemApplied:
+			result.Code = http.StatusOK
+			if result.Op == models.BatchCreate {
+				result.Code = http.StatusCreated
+			}
+		case models.BatchItemFailed:
+			result.Code, result.Error = batchItemCode(result.Err), result.Err.Error()
+		}
+	}
+
+	// A failed atomic batch changed nothing.
+	if response.Mode == models.BatchAtomic && response.Failed > 0 {
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// batchItemCode returns the status a failed operation would have had as a
+// request of its own.
+func batchItemCode(err error) int {
+	switch errors.Cause(err) {
+	case service.ErrInvalidBatch, service.ErrInvalidBilling, service.ErrInvalidSubscription:
+		return http.StatusBadRequest
+	case service.ErrForbidden:
+		return http.StatusForbidden
+	case service.ErrSubscriptionNotFound:
+		return http.StatusNotFound
+	case service.ErrInvalidTransition:
+		return http.StatusConflict
+	case service.ErrPreconditionFailed:
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusInternalServerError
+	}
+}
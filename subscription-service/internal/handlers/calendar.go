@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"subscription-service/internal/auth"
+	"subscription-service/internal/models"
+	"subscription-service/internal/service"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// icsLineLength is the length in octets lines of iCalendar files are folded
+// at, not counting the line break (RFC 5545, section 3.1).
+const icsLineLength = 75
+
+// icsWeekdays are the iCalendar names of the ISO weekdays, Monday first.
+var icsWeekdays = []string{"MO", "TU", "WE", "TH", "FR", "SA", "SU"}
+
+// IssueCalendarToken godoc
+// @Summary Issue a calendar token
+// @Description Issue the secret token of the charges feed of a user, replacing the previous one. The token is only returned by this request.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "User ID"
+// @Success 201 {object} models.CalendarToken
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/{id}/calendar-token [post]
+func (h *UserHandler) IssueCalendarToken(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	token, err := h.service.IssueCalendarToken(c.Request.Context(), id)
+	if err != nil {
+		writeCalendarTokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, &models.CalendarToken{
+		Token: token,
+		URL:   "/api/v1/users/" + id.String() + "/charges.ics?token=" + token,
+	})
+}
+
+// RevokeCalendarToken godoc
+// @Summary Revoke the calendar token
+// @Description Revoke the token of the charges feed of a user, which closes the feed until a new token is issued
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/{id}/calendar-token [delete]
+func (h *UserHandler) RevokeCalendarToken(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	if err := h.service.RevokeCalendarToken(c.Request.Context(), id); err != nil {
+		writeCalendarTokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "calendar token revoked successfully"})
+}
+
+func writeCalendarTokenError(c *gin.Context, err error) {
+	switch errors.Cause(err) {
+	case service.ErrForbidden:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": auth.ReasonNotOwner})
+	case service.ErrUserNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// GetChargesCalendar godoc
+// @Summary Get the charges feed of a user
+// @Description Get an iCalendar (RFC 5545) feed with a recurring all-day event per billed subscription of the user, on the days it is charged. Calendar apps cannot authenticate, so the feed is protected by the calendar token of the user instead.
+// @Tags users
+// @Produce text/calendar
+// @Param id path string true "User ID"
+// @Param token query string true "Calendar token"
+// @Success 200 {string} string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/{id}/charges.ics [get]
+func (h *UserHandler) GetChargesCalendar(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	user, schedule, err := h.service.GetChargeSchedule(c.Request.Context(), id, c.Query("token"))
+	if err != nil {
+		if errors.Cause(err) == service.ErrInvalidCalendarToken {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", chargesCalendar(user, schedule, time.Now()))
+}
+
+// chargesCalendar renders the charge schedule of a user as an iCalendar
+// file.
+func chargesCalendar(user *models.User, schedule []*models.ChargeSeries, now time.Time) []byte {
+	var buf bytes.Buffer
+	line := func(format string, args ...interface{}) {
+		writeICSLine(&buf, fmt.Sprintf(format, args...))
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//subscription-service//charges//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:%s", escapeICSText("Subscription charges of "+user.Name))
+
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, series := range schedule {
+		sub := series.Subscription
+		price := formatPrice(sub.Price, sub.Currency)
+
+		line("BEGIN:VEVENT")
+		line("UID:%s@subscription-service", sub.ID)
+		line("DTSTAMP:%s", stamp)
+		line("LAST-MODIFIED:%s", sub.UpdatedAt.UTC().Format("20060102T150405Z"))
+		line("DTSTART;VALUE=DATE:%s", series.First.Format("20060102"))
+		line("RRULE:%s", chargeRule(series))
+		line("SUMMARY:%s", escapeICSText(sub.ServiceName+" "+price))
+		line("DESCRIPTION:%s", escapeICSText(fmt.Sprintf("%s is charged %s, billed %s.", sub.ServiceName, price, billingDescription(sub))))
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+	return buf.Bytes()
+}
+
+// chargeRule returns the recurrence rule of a charge series. Charges on
+// anchor days missing from shorter months move to their last day, which is
+// the last of the days up to the anchor day a month has.
+func chargeRule(series *models.ChargeSeries) string {
+	sub := series.Subscription
+
+	var rule string
+	if sub.BillingPeriod == models.BillingWeekly {
+		rule = fmt.Sprintf("FREQ=WEEKLY;INTERVAL=%d;BYDAY=%s", sub.BillingInterval, icsWeekdays[sub.BillingAnchorDay-1])
+	} else if sub.BillingAnchorDay <= 28 {
+		rule = fmt.Sprintf("FREQ=MONTHLY;INTERVAL=%d;BYMONTHDAY=%d", sub.BillingInterval, sub.BillingAnchorDay)
+	} else {
+		days := make([]string, 0, sub.BillingAnchorDay-27)
+		for day := 28; day <= sub.BillingAnchorDay; day++ {
+			days = append(days, fmt.Sprint(day))
+		}
+		rule = fmt.Sprintf("FREQ=MONTHLY;INTERVAL=%d;BYMONTHDAY=%s;BYSETPOS=-1", sub.BillingInterval, strings.Join(days, ","))
+	}
+
+	if series.Until != nil {
+		rule += ";UNTIL=" + series.Until.Format("20060102")
+	}
+	return rule
+}
+
+func billingDescription(sub *models.Subscription) string {
+	switch {
+	case sub.BillingPeriod != models.BillingCustom:
+		return string(sub.BillingPeriod)
+	case sub.BillingInterval == 1:
+		return "every month"
+	default:
+		return fmt.Sprintf("every %d months", sub.BillingInterval)
+	}
+}
+
+// formatPrice renders a price in minor units in the major units of its
+// currency, e.g. 999 USD as 9.99 USD.
+func formatPrice(price int, currency string) string {
+	units := models.MinorUnits(currency)
+	if units == 0 {
+		return fmt.Sprintf("%d %s", price, currency)
+	}
+
+	divisor := 1
+	for i := 0; i < units; i++ {
+		divisor *= 10
+	}
+	return fmt.Sprintf("%d.%0*d %s", price/divisor, units, price%divisor, currency)
+}
+
+// escapeICSText escapes a TEXT value (RFC 5545, section 3.3.11).
+func escapeICSText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", "").Replace(text)
+}
+
+// writeICSLine writes a content line terminated by CRLF, folded so that no
+// line exceeds icsLineLength octets. Folding never splits a UTF-8 sequence.
+func writeICSLine(buf *bytes.Buffer, line string) {
+	limit := icsLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		buf.WriteString(line[:cut])
+		buf.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with the space that marks them.
+		limit = icsLineLength - 1
+	}
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+}
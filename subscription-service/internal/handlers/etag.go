@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+	"subscription-service/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// setETag tags the response with the version of sub as a strong ETag.
+func setETag(c *gin.Context, sub *models.Subscription) {
+	c.Header("ETag", strconv.Quote(strconv.Itoa(sub.Version)))
+}
+
+// parseIfMatch returns the version required by the If-Match header, or nil
+// when the request has none or accepts any version with *. Weak and
+// malformed ETags never match.
+func parseIfMatch(c *gin.Context) (*int, error) {
+	value := strings.TrimSpace(c.GetHeader("If-Match"))
+	if value == "" || value == "*" {
+		return nil, nil
+	}
+
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return nil, errors.Errorf("If-Match %s does not match the current ETag", value)
+	}
+	version, err := strconv.Atoi(value[1 : len(value)-1])
+	if err != nil {
+		return nil, errors.Errorf("If-Match %s does not match the current ETag", value)
+	}
+
+	return &version, nil
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"subscription-service/internal/auth"
+	"subscription-service/internal/models"
+	"subscription-service/internal/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// eventStreamReset is the type of the event that starts streams resuming
+// from an event that is no longer retained.
+const eventStreamReset = "reset"
+
+type EventHandler struct {
+	service   service.EventBroker
+	heartbeat time.Duration
+}
+
+// NewEventHandler creates the handler of event streams, which send a
+// heartbeat every heartbeat interval to keep idle connections open.
+func NewEventHandler(service service.EventBroker, heartbeat time.Duration) *EventHandler {
+	return &EventHandler{service: service, heartbeat: heartbeat}
+}
+
+// StreamEvents godoc
+// @Summary Stream subscription events
+// @Description Stream the events of created, updated and deleted subscriptions as server-sent events, each with the event ID as id, its type as event and the event as JSON data. Comments are sent as heartbeats while there are no events. Clients reconnecting with a Last-Event-ID header receive the retained events they missed; when that event is no longer retained, the stream starts with a reset event and clients should reload the subscriptions instead. Members only receive events of their own subscriptions.
+// @Tags events
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param user_id query []string false "User IDs, repeated or comma separated" collectionFormat(multi)
+// @Param service_name query string false "Service name, matched when contained ignoring case"
+// @Param Last-Event-ID header string false "ID of the last event received"
+// @Success 200 {string} string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /events [get]
+func (h *EventHandler) StreamEvents(c *gin.Context) {
+	userIDs, err := parseUserIDs(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter := &models.EventFilter{UserIDs: userIDs}
+	if serviceName := c.Query("service_name"); serviceName != "" {
+		filter.ServiceName = &serviceName
+	}
+
+	var lastEventID *uuid.UUID
+	if value := c.GetHeader("Last-Event-ID"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid last event id"})
+			return
+		}
+		lastEventID = &id
+	}
+
+	ctx := c.Request.Context()
+	stream, err := h.service.Subscribe(ctx, filter, lastEventID)
+	if err != nil {
+		if errors.Cause(err) == service.ErrForbidden {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": auth.ReasonNotOwner})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer stream.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	// Keeps proxies such as nginx from buffering the stream.
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if stream.Reset {
+		if err := writeServerSentEvent(c.Writer, "", eventStreamReset, []byte("{}")); err != nil {
+			return
+		}
+	}
+	for _, event := range stream.Replay {
+		if err := writeEvent(c.Writer, event); err != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-stream.Events:
+			// Closed streams end the response; clients reconnect and
+			// resume from the last event they received.
+			if !ok {
+				return
+			}
+			if err := writeEvent(c.Writer, event); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+func writeEvent(w io.Writer, event *models.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode event")
+	}
+	return writeServerSentEvent(w, event.ID.String(), string(event.Type), data)
+}
+
+// writeServerSentEvent writes an event in the text/event-stream format. data
+// must not contain line breaks, which holds for encoded JSON.
+func writeServerSentEvent(w io.Writer, id, eventType string, data []byte) error {
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, data)
+	return err
+}
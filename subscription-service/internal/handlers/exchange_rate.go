@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"subscription-service/internal/models"
+	"subscription-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+type ExchangeRateHandler struct {
+	service service.ExchangeRateService
+}
+
+func NewExchangeRateHandler(service service.ExchangeRateService) *ExchangeRateHandler {
+	return &ExchangeRateHandler{service: service}
+}
+
+// SetExchangeRates godoc
+// @Summary Set exchange rates
+// @Description Store monthly exchange rates, replacing rates known for the same currency pair and month. Rates apply to all tenants, so only admins not bound to a tenant may set them.
+// @Tags exchange-rates
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param request body models.SetExchangeRatesRequest true "Exchange rates"
+// @Success 200 {array} models.ExchangeRate
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /exchange-rates [put]
+func (h *ExchangeRateHandler) SetExchangeRates(c *gin.Context) {
+	var req models.SetExchangeRatesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rates, err := h.service.SetRates(c.Request.Context(), &req)
+	if err != nil {
+		if errors.Cause(err) == service.ErrInvalidExchangeRate {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rates)
+}
+
+// ListExchangeRates godoc
+// @Summary List exchange rates
+// @Description Get known exchange rates, optionally for one base or quote currency
+// @Tags exchange-rates
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param base_currency query string false "Base currency (ISO 4217)"
+// @Param quote_currency query string false "Quote currency (ISO 4217)"
+// @Success 200 {array} models.ExchangeRate
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /exchange-rates [get]
+func (h *ExchangeRateHandler) ListExchangeRates(c *gin.Context) {
+	rates, err := h.service.ListRates(c.Request.Context(), c.Query("base_currency"), c.Query("quote_currency"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rates)
+}
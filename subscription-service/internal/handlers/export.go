@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"subscription-service/internal/auth"
+	"subscription-service/internal/models"
+	"subscription-service/internal/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// exportFlushRows is the number of rows after which exports are flushed to
+// the client.
+const exportFlushRows = 100
+
+// exportErrorTrailer reports failures that happen after the first rows of an
+// export have been sent, when the status can no longer change.
+const exportErrorTrailer = "X-Export-Error"
+
+// subscriptionEncoder writes subscriptions in an export format.
+type subscriptionEncoder interface {
+	// Begin writes what precedes the first subscription.
+	Begin() error
+	Encode(sub *models.Subscription) error
+	Flush() error
+}
+
+// ExportSubscriptions godoc
+// @Summary Export subscriptions as CSV or NDJSON
+// @Description Stream every subscription matching the filters, without paging. CSV exports start with a header row and use the date formats of requests, so they can be imported again; NDJSON exports hold one subscription per line as returned by the other endpoints. Failures after the first rows have been sent end the response early and are reported in the X-Export-Error trailer.
+// @Tags subscriptions
+// @Produce text/csv,application/x-ndjson
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param format query string false "Export format" Enums(csv, ndjson) default(csv)
+// @Param user_id query []string false "User IDs, repeated or comma separated" collectionFormat(multi)
+// @Param service_id query string false "Catalog service ID"
+// @Param service_name query string false "Service name"
+// @Param service_name_match query string false "Service name matching; exact also matches catalog aliases" Enums(contains, exact)
+// @Param start_date query string false "Start of the period (MM-YYYY)"
+// @Param end_date query string false "End of the period (MM-YYYY)"
+// @Param start_from query string false "Earliest subscription start (MM-YYYY)"
+// @Param start_to query string false "Latest subscription start (MM-YYYY)"
+// @Param end_from query string false "Earliest subscription end (MM-YYYY)"
+// @Param end_to query string false "Latest subscription end (MM-YYYY)"
+// @Param active_at query string false "Month the subscription is active in (MM-YYYY)"
+// @Param price_min query int false "Minimum price per billing period"
+// @Param price_max query int false "Maximum price per billing period"
+// @Param open_ended query bool false "Only subscriptions without (true) or with (false) an end date"
+// @Param include_deleted query bool false "Include deleted subscriptions (admins only)"
+// @Param sort query string false "Sort field" Enums(created_at, price, start_date, service_name)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Success 200 {string} string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /subscriptions/export [get]
+func (h *SubscriptionHandler) ExportSubscriptions(c *gin.Context) {
+	filter, err := parseSubscriptionFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sort, order, err := parseSort(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format := models.ExportFormat(c.DefaultQuery("format", string(models.ExportCSV)))
+	var encoder subscriptionEncoder
+	var contentType string
+	switch format {
+	case models.ExportCSV:
+		encoder, contentType = &csvEncoder{w: csv.NewWriter(c.Writer)}, "text/csv; charset=utf-8"
+	case models.ExportNDJSON:
+		encoder, contentType = &ndjsonEncoder{enc: json.NewEncoder(c.Writer)}, "application/x-ndjson"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or ndjson"})
+		return
+	}
+
+	// Nothing is written before the first subscription has been read, so
+	// that errors up to then still get a status of their own.
+	rows := 0
+	begin := func() error {
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", `attachment; filename="subscriptions.`+string(format)+`"`)
+		c.Header("Trailer", exportErrorTrailer)
+		c.Status(http.StatusOK)
+		return encoder.Begin()
+	}
+
+	err = h.service.ExportSubscriptions(c.Request.Context(), filter, sort, order, func(sub *models.Subscription) error {
+		if rows == 0 {
+			if err := begin(); err != nil {
+				return err
+			}
+		}
+		if err := encoder.Encode(sub); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushRows == 0 {
+			if err := encoder.Flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil && rows == 0 {
+		err = begin()
+	}
+	if err == nil {
+		err = encoder.Flush()
+	}
+
+	if err != nil && rows > 0 {
+		log.Printf("Export of subscriptions failed after %d rows: %v", rows, err)
+		c.Writer.Header().Set(exportErrorTrailer, err.Error())
+		return
+	}
+
+	if err != nil {
+		switch errors.Cause(err) {
+		case service.ErrForbidden:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": auth.ReasonNotOwner})
+		case service.ErrAdminRequired:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": auth.ReasonMissingRole})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) Begin() error {
+	return e.w.Write(models.ExportColumns)
+}
+
+func (e *csvEncoder) Encode(sub *models.Subscription) error {
+	return e.w.Write([]string{
+		sub.ID.String(),
+		sub.ServiceName,
+		formatOptionalID(sub.ServiceID),
+		strconv.Itoa(sub.Price),
+		sub.Currency,
+		sub.UserID.String(),
+		sub.StartDate.Format("01-2006"),
+		formatOptionalTime(sub.EndDate, "01-2006"),
+		string(sub.Status),
+		string(sub.BillingPeriod),
+		strconv.Itoa(sub.BillingInterval),
+		strconv.Itoa(sub.BillingAnchorDay),
+		formatOptionalTime(sub.NextBillingDate, "2006-01-02"),
+		sub.CreatedAt.Format(time.RFC3339),
+		sub.UpdatedAt.Format(time.RFC3339),
+		formatOptionalTime(sub.DeletedAt, time.RFC3339),
+		strconv.Itoa(sub.Version),
+	})
+}
+
+func (e *csvEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) Begin() error {
+	return nil
+}
+
+// Encode writes sub on a line of its own; json.Encoder ends every value
+// with a newline.
+func (e *ndjsonEncoder) Encode(sub *models.Subscription) error {
+	return e.enc.Encode(sub)
+}
+
+func (e *ndjsonEncoder) Flush() error {
+	return nil
+}
+
+func formatOptionalID(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+func formatOptionalTime(t *time.Time, layout string) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(layout)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"subscription-service/internal/models"
+	"subscription-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// maxImportSize caps the size of uploads of subscriptions.
+const maxImportSize = 10 << 20
+
+// ImportSubscriptions godoc
+// @Summary Import subscriptions from CSV or NDJSON
+// @Description Create subscriptions from the rows of a CSV file with a header row or of an NDJSON file, sent as the request body or as the file field of a multipart form. Rows are validated like requests to create a subscription. Columns or keys are matched to fields by name unless mapped with mapping[field]=column. Dry runs only report on the rows; otherwise all rows are imported in a single transaction, or none when any row is invalid.
+// @Tags subscriptions
+// @Accept text/csv,application/x-ndjson,multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param format query string false "File format, detected from the content type when omitted" Enums(csv, ndjson)
+// @Param dry_run query bool false "Only validate the rows"
+// @Param mapping query object false "Columns or keys holding the fields, e.g. mapping[price]=Cost"
+// @Param file formData file false "File to import"
+// @Success 200 {object} models.ImportReport
+// @Success 201 {object} models.ImportReport
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 422 {object} models.ImportReport
+// @Failure 500 {object} map[string]string
+// @Router /subscriptions/import [post]
+func (h *SubscriptionHandler) ImportSubscriptions(c *gin.Context) {
+	opts := &models.ImportOptions{Mapping: c.QueryMap("mapping")}
+
+	if value := c.Query("dry_run"); value != "" {
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run must be true or false"})
+			return
+		}
+		opts.DryRun = dryRun
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	body, contentType, err := importFile(c)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "uploads are limited to 10 MiB"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer body.Close()
+
+	opts.Format = models.ImportFormat(c.Query("format"))
+	if opts.Format == "" {
+		switch contentType {
+		case "text/csv":
+			opts.Format = models.ImportCSV
+		case "application/x-ndjson", "application/jsonl":
+			opts.Format = models.ImportNDJSON
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be given for content type " + strconv.Quote(contentType)})
+			return
+		}
+	}
+
+	report, err := h.service.ImportSubscriptions(c.Request.Context(), body, opts)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "uploads are limited to 10 MiB"})
+		case errors.Cause(err) == service.ErrInvalidImport:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	switch {
+	case report.Invalid > 0 && !report.DryRun:
+		c.JSON(http.StatusUnprocessableEntity, report)
+	case report.DryRun:
+		c.JSON(http.StatusOK, report)
+	default:
+		c.JSON(http.StatusCreated, report)
+	}
+}
+
+// importFile returns the uploaded file and its media type, taken from the
+// file field of multipart forms and from the body otherwise.
+func importFile(c *gin.Context) (io.ReadCloser, string, error) {
+	contentType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if contentType != "multipart/form-data" {
+		return c.Request.Body, contentType, nil
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, "", errors.Wrap(err, "missing file field")
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to open uploaded file")
+	}
+	contentType, _, _ = mime.ParseMediaType(header.Header.Get("Content-Type"))
+	return file, contentType, nil
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"net/http"
+	"subscription-service/internal/models"
+	"subscription-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+type ServiceHandler struct {
+	service service.CatalogService
+}
+
+func NewServiceHandler(service service.CatalogService) *ServiceHandler {
+	return &ServiceHandler{service: service}
+}
+
+// CreateService godoc
+// @Summary Create a service
+// @Description Add a service to the catalog; existing subscriptions named after it or one of its aliases are linked to it
+// @Tags services
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param request body models.CreateServiceRequest true "Service data"
+// @Success 201 {object} models.Service
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /services [post]
+func (h *ServiceHandler) CreateService(c *gin.Context) {
+	var req models.CreateServiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	svc, err := h.service.CreateService(c.Request.Context(), &req)
+	if err != nil {
+		if errors.Cause(err) == service.ErrServiceConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, svc)
+}
+
+// GetService godoc
+// @Summary Get service by ID
+// @Description Get a catalog service with its aliases
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Service ID"
+// @Success 200 {object} models.Service
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /services/{id} [get]
+func (h *ServiceHandler) GetService(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid service id"})
+		return
+	}
+
+	svc, err := h.service.GetService(c.Request.Context(), id)
+	if err != nil {
+		if errors.Cause(err) == service.ErrServiceNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "service not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, svc)
+}
+
+// UpdateService godoc
+// @Summary Update service
+// @Description Update a catalog service; given aliases replace the current ones
+// @Tags services
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Service ID"
+// @Param request body models.UpdateServiceRequest true "Service update data"
+// @Success 200 {object} models.Service
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /services/{id} [put]
+func (h *ServiceHandler) UpdateService(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid service id"})
+		return
+	}
+
+	var req models.UpdateServiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	svc, err := h.service.UpdateService(c.Request.Context(), id, &req)
+	if err != nil {
+		switch errors.Cause(err) {
+		case service.ErrServiceNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "service not found"})
+		case service.ErrServiceConflict:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, svc)
+}
+
+// DeleteService godoc
+// @Summary Delete service
+// @Description Remove a service from the catalog; its subscriptions are unlinked but kept
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Service ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /services/{id} [delete]
+func (h *ServiceHandler) DeleteService(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid service id"})
+		return
+	}
+
+	if err := h.service.DeleteService(c.Request.Context(), id); err != nil {
+		if errors.Cause(err) == service.ErrServiceNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "service not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "service deleted successfully"})
+}
+
+// ListServices godoc
+// @Summary List services
+// @Description Get the service catalog ordered by name
+// @Tags services
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param category query string false "Category"
+// @Success 200 {array} models.Service
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /services [get]
+func (h *ServiceHandler) ListServices(c *gin.Context) {
+	services, err := h.service.ListServices(c.Request.Context(), c.Query("category"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, services)
+}
@@ -1,9 +1,14 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
+	"strconv"
+	"strings"
+	"subscription-service/internal/auth"
 	"subscription-service/internal/models"
 	"subscription-service/internal/service"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -14,19 +19,30 @@ type SubscriptionHandler struct {
 	service service.SubscriptionService
 }
 
+// maxIdempotencyKeyLength is the size of the column idempotency keys are
+// stored in.
+const maxIdempotencyKeyLength = 255
+
 func NewSubscriptionHandler(service service.SubscriptionService) *SubscriptionHandler {
 	return &SubscriptionHandler{service: service}
 }
 
 // CreateSubscription godoc
 // @Summary Create a new subscription
-// @Description Create a new subscription for a user
+// @Description Create a new subscription for a user. Retries sent with the same Idempotency-Key return the subscription created first.
 // @Tags subscriptions
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param Idempotency-Key header string false "Key identifying retries of the same request"
 // @Param request body models.CreateSubscriptionRequest true "Subscription data"
 // @Success 201 {object} models.Subscription
+// @Header 201 {string} Idempotent-Replayed "true when the response is replayed for a retry"
 // @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 422 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /subscriptions [post]
 func (h *SubscriptionHandler) CreateSubscription(c *gin.Context) {
@@ -36,12 +52,38 @@ func (h *SubscriptionHandler) CreateSubscription(c *gin.Context) {
 		return
 	}
 
-	subscription, err := h.service.CreateSubscription(c.Request.Context(), &req)
+	key := c.GetHeader(models.IdempotencyKeyHeader)
+	if len(key) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "idempotency key is too long"})
+		return
+	}
+
+	var subscription *models.Subscription
+	var replayed bool
+	var err error
+	if key != "" {
+		subscription, replayed, err = h.service.CreateSubscriptionOnce(c.Request.Context(), key, &req)
+	} else {
+		subscription, err = h.service.CreateSubscription(c.Request.Context(), &req)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		switch errors.Cause(err) {
+		case service.ErrInvalidBilling, service.ErrInvalidSubscription:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case service.ErrForbidden:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": auth.ReasonNotOwner})
+		case service.ErrIdempotencyKeyReused:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
+	if replayed {
+		c.Header("Idempotent-Replayed", "true")
+	}
+	setETag(c, subscription)
 	c.JSON(http.StatusCreated, subscription)
 }
 
@@ -50,9 +92,14 @@ func (h *SubscriptionHandler) CreateSubscription(c *gin.Context) {
 // @Description Get subscription details by ID
 // @Tags subscriptions
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path string true "Subscription ID"
+// @Param include_deleted query bool false "Also find a deleted subscription (admins only)"
 // @Success 200 {object} models.Subscription
 // @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /subscriptions/{id} [get]
@@ -63,30 +110,48 @@ func (h *SubscriptionHandler) GetSubscription(c *gin.Context) {
 		return
 	}
 
-	subscription, err := h.service.GetSubscription(c.Request.Context(), id)
+	includeDeleted, err := parseIncludeDeleted(c)
 	if err != nil {
-		if errors.Cause(err).Error() == "subscription not found" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subscription, err := h.service.GetSubscription(c.Request.Context(), id, includeDeleted)
+	if err != nil {
+		switch errors.Cause(err) {
+		case service.ErrSubscriptionNotFound:
 			c.JSON(http.StatusNotFound, gin.H{"error": "subscription not found"})
-			return
+		case service.ErrAdminRequired:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": auth.ReasonMissingRole})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	setETag(c, subscription)
 	c.JSON(http.StatusOK, subscription)
 }
 
 // UpdateSubscription godoc
 // @Summary Update subscription
-// @Description Update subscription details
+// @Description Update subscription details. A new currency has to come with a new price, which applies from price_effective_from on; earlier prices keep their currency. The end date and billing of cancelled and expired subscriptions cannot be changed. With If-Match the update only applies while the subscription still has that ETag.
 // @Tags subscriptions
 // @Accept json
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path string true "Subscription ID"
+// @Param If-Match header string false "ETag the subscription must still have"
 // @Param request body models.UpdateSubscriptionRequest true "Subscription update data"
 // @Success 200 {object} map[string]string
+// @Header 200 {string} ETag "ETag of the updated subscription"
 // @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 412 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /subscriptions/{id} [put]
 func (h *SubscriptionHandler) UpdateSubscription(c *gin.Context) {
@@ -102,27 +167,48 @@ func (h *SubscriptionHandler) UpdateSubscription(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.UpdateSubscription(c.Request.Context(), id, &req); err != nil {
-		if errors.Cause(err).Error() == "subscription not found" {
+	ifMatch, err := parseIfMatch(c)
+	if err != nil {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		return
+	}
+
+	subscription, err := h.service.UpdateSubscription(c.Request.Context(), id, &req, ifMatch)
+	if err != nil {
+		switch errors.Cause(err) {
+		case service.ErrSubscriptionNotFound:
 			c.JSON(http.StatusNotFound, gin.H{"error": "subscription not found"})
-			return
+		case service.ErrInvalidBilling, service.ErrInvalidSubscription:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case service.ErrInvalidTransition:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case service.ErrPreconditionFailed:
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	setETag(c, subscription)
 	c.JSON(http.StatusOK, gin.H{"message": "subscription updated successfully"})
 }
 
 // DeleteSubscription godoc
 // @Summary Delete subscription
-// @Description Delete subscription by ID
+// @Description Delete subscription by ID. It can be restored until it is purged after the retention period. With If-Match it is only deleted while it still has that ETag.
 // @Tags subscriptions
 // @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path string true "Subscription ID"
+// @Param If-Match header string false "ETag the subscription must still have"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 412 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /subscriptions/{id} [delete]
 func (h *SubscriptionHandler) DeleteSubscription(c *gin.Context) {
@@ -132,8 +218,156 @@ func (h *SubscriptionHandler) DeleteSubscription(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.DeleteSubscription(c.Request.Context(), id); err != nil {
-		if errors.Cause(err).Error() == "subscription not found" {
+	ifMatch, err := parseIfMatch(c)
+	if err != nil {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.DeleteSubscription(c.Request.Context(), id, ifMatch); err != nil {
+		switch errors.Cause(err) {
+		case service.ErrSubscriptionNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "subscription not found"})
+		case service.ErrPreconditionFailed:
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "subscription deleted successfully"})
+}
+
+// RestoreSubscription godoc
+// @Summary Restore subscription
+// @Description Restore a deleted subscription that has not been purged yet. Subscriptions of deleted users cannot be restored.
+// @Tags subscriptions
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} models.Subscription
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /subscriptions/{id}/restore [post]
+func (h *SubscriptionHandler) RestoreSubscription(c *gin.Context) {
+	h.changeStatus(c, h.service.RestoreSubscription)
+}
+
+// PauseSubscription godoc
+// @Summary Pause subscription
+// @Description Pause a subscription; paused months are not billed
+// @Tags subscriptions
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} models.Subscription
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /subscriptions/{id}/pause [post]
+func (h *SubscriptionHandler) PauseSubscription(c *gin.Context) {
+	h.changeStatus(c, h.service.PauseSubscription)
+}
+
+// ResumeSubscription godoc
+// @Summary Resume subscription
+// @Description Resume a paused subscription or activate a trial one
+// @Tags subscriptions
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} models.Subscription
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /subscriptions/{id}/resume [post]
+func (h *SubscriptionHandler) ResumeSubscription(c *gin.Context) {
+	h.changeStatus(c, h.service.ResumeSubscription)
+}
+
+// CancelSubscription godoc
+// @Summary Cancel subscription
+// @Description Cancel a subscription; it ends with the current month
+// @Tags subscriptions
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} models.Subscription
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /subscriptions/{id}/cancel [post]
+func (h *SubscriptionHandler) CancelSubscription(c *gin.Context) {
+	h.changeStatus(c, h.service.CancelSubscription)
+}
+
+func (h *SubscriptionHandler) changeStatus(c *gin.Context, change func(ctx context.Context, id uuid.UUID) (*models.Subscription, error)) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription id"})
+		return
+	}
+
+	subscription, err := change(c.Request.Context(), id)
+	if err != nil {
+		switch errors.Cause(err) {
+		case service.ErrSubscriptionNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "subscription not found"})
+		case service.ErrInvalidTransition:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	setETag(c, subscription)
+	c.JSON(http.StatusOK, subscription)
+}
+
+// GetPriceHistory godoc
+// @Summary Get price history
+// @Description Get the price changes of a subscription with the months they apply from
+// @Tags subscriptions
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Subscription ID"
+// @Success 200 {array} models.PriceChange
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /subscriptions/{id}/history [get]
+func (h *SubscriptionHandler) GetPriceHistory(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription id"})
+		return
+	}
+
+	history, err := h.service.GetPriceHistory(c.Request.Context(), id)
+	if err != nil {
+		if errors.Cause(err) == service.ErrSubscriptionNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "subscription not found"})
 			return
 		}
@@ -141,38 +375,66 @@ func (h *SubscriptionHandler) DeleteSubscription(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "subscription deleted successfully"})
+	c.JSON(http.StatusOK, history)
 }
 
 // ListSubscriptions godoc
 // @Summary List subscriptions
-// @Description Get list of subscriptions with optional filtering
+// @Description Get a page of subscriptions with optional filtering and sorting
 // @Tags subscriptions
 // @Produce json
-// @Param user_id query string false "User ID"
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param user_id query []string false "User IDs, repeated or comma separated" collectionFormat(multi)
+// @Param service_id query string false "Catalog service ID"
 // @Param service_name query string false "Service name"
-// @Success 200 {array} models.Subscription
+// @Param service_name_match query string false "Service name matching; exact also matches catalog aliases" Enums(contains, exact)
+// @Param start_date query string false "Start of the period (MM-YYYY)"
+// @Param end_date query string false "End of the period (MM-YYYY)"
+// @Param start_from query string false "Earliest subscription start (MM-YYYY)"
+// @Param start_to query string false "Latest subscription start (MM-YYYY)"
+// @Param end_from query string false "Earliest subscription end (MM-YYYY)"
+// @Param end_to query string false "Latest subscription end (MM-YYYY)"
+// @Param active_at query string false "Month the subscription is active in (MM-YYYY)"
+// @Param price_min query int false "Minimum price per billing period"
+// @Param price_max query int false "Maximum price per billing period"
+// @Param open_ended query bool false "Only subscriptions without (true) or with (false) an end date"
+// @Param include_deleted query bool false "Include deleted subscriptions (admins only)"
+// @Param limit query int false "Page size (1-100, default 20)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field" Enums(created_at, price, start_date, service_name)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Success 200 {object} models.SubscriptionPage
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /subscriptions [get]
 func (h *SubscriptionHandler) ListSubscriptions(c *gin.Context) {
-	var filter models.SubscriptionFilter
-
-	if userID := c.Query("user_id"); userID != "" {
-		id, err := uuid.Parse(userID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
-			return
-		}
-		filter.UserID = &id
+	filter, err := parseSubscriptionFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	if serviceName := c.Query("service_name"); serviceName != "" {
-		filter.ServiceName = &serviceName
+	page, err := parsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	subscriptions, err := h.service.ListSubscriptions(c.Request.Context(), &filter)
+	subscriptions, err := h.service.ListSubscriptions(c.Request.Context(), filter, page)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		switch errors.Cause(err) {
+		case service.ErrForbidden:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": auth.ReasonNotOwner})
+		case service.ErrAdminRequired:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": auth.ReasonMissingRole})
+		case service.ErrInvalidCursor:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
@@ -181,46 +443,351 @@ func (h *SubscriptionHandler) ListSubscriptions(c *gin.Context) {
 
 // GetTotalCost godoc
 // @Summary Get total cost of subscriptions
-// @Description Calculate total cost of subscriptions for a period with optional filters
+// @Description Calculate total cost of the charges of subscriptions falling into a period
 // @Tags subscriptions
 // @Produce json
-// @Param user_id query string false "User ID"
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param user_id query []string false "User IDs, repeated or comma separated" collectionFormat(multi)
+// @Param service_id query string false "Catalog service ID"
 // @Param service_name query string false "Service name"
-// @Param start_date query string false "Start date (MM-YYYY)"
-// @Param end_date query string false "End date (MM-YYYY)"
+// @Param service_name_match query string false "Service name matching; exact also matches catalog aliases" Enums(contains, exact)
+// @Param start_date query string false "Start of the period (MM-YYYY)"
+// @Param end_date query string false "End of the period (MM-YYYY)"
+// @Param start_from query string false "Earliest subscription start (MM-YYYY)"
+// @Param start_to query string false "Latest subscription start (MM-YYYY)"
+// @Param end_from query string false "Earliest subscription end (MM-YYYY)"
+// @Param end_to query string false "Latest subscription end (MM-YYYY)"
+// @Param active_at query string false "Month the subscription is active in (MM-YYYY)"
+// @Param price_min query int false "Minimum price per billing period"
+// @Param price_max query int false "Maximum price per billing period"
+// @Param open_ended query bool false "Only subscriptions without (true) or with (false) an end date"
+// @Param include_deleted query bool false "Include deleted subscriptions (admins only)"
+// @Param currency query string false "Currency to convert the cost into (ISO 4217)"
 // @Success 200 {object} models.TotalCostResponse
 // @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 422 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /subscriptions/total-cost [get]
 func (h *SubscriptionHandler) GetTotalCost(c *gin.Context) {
+	filter, err := parseSubscriptionFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	currency, err := parseCurrency(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	totalCost, err := h.service.GetTotalCost(c.Request.Context(), filter, currency)
+	if err != nil {
+		switch errors.Cause(err) {
+		case service.ErrForbidden:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": auth.ReasonNotOwner})
+		case service.ErrAdminRequired:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": auth.ReasonMissingRole})
+		case service.ErrMissingExchangeRate:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, totalCost)
+}
+
+// GetCostBreakdown godoc
+// @Summary Get per-month cost breakdown of subscriptions
+// @Description Break down the cost of the charges of subscriptions falling into a period by month, service and user
+// @Tags subscriptions
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param user_id query []string false "User IDs, repeated or comma separated" collectionFormat(multi)
+// @Param service_id query string false "Catalog service ID"
+// @Param service_name query string false "Service name"
+// @Param service_name_match query string false "Service name matching; exact also matches catalog aliases" Enums(contains, exact)
+// @Param start_date query string true "Start of the period (MM-YYYY)"
+// @Param end_date query string true "End of the period (MM-YYYY)"
+// @Param start_from query string false "Earliest subscription start (MM-YYYY)"
+// @Param start_to query string false "Latest subscription start (MM-YYYY)"
+// @Param end_from query string false "Earliest subscription end (MM-YYYY)"
+// @Param end_to query string false "Latest subscription end (MM-YYYY)"
+// @Param active_at query string false "Month the subscription is active in (MM-YYYY)"
+// @Param price_min query int false "Minimum price per billing period"
+// @Param price_max query int false "Maximum price per billing period"
+// @Param open_ended query bool false "Only subscriptions without (true) or with (false) an end date"
+// @Param include_deleted query bool false "Include deleted subscriptions (admins only)"
+// @Param currency query string false "Currency to convert the costs into (ISO 4217)"
+// @Success 200 {object} models.CostBreakdownResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /subscriptions/total-cost/breakdown [get]
+func (h *SubscriptionHandler) GetCostBreakdown(c *gin.Context) {
+	filter, err := parseSubscriptionFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if filter.StartDate == nil || filter.EndDate == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_date and end_date are required"})
+		return
+	}
+
+	currency, err := parseCurrency(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	breakdown, err := h.service.GetCostBreakdown(c.Request.Context(), filter, currency)
+	if err != nil {
+		switch errors.Cause(err) {
+		case service.ErrForbidden:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": auth.ReasonNotOwner})
+		case service.ErrAdminRequired:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": auth.ReasonMissingRole})
+		case service.ErrMissingExchangeRate:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, breakdown)
+}
+
+// GetCostByService godoc
+// @Summary Get cost of subscriptions per service
+// @Description Sum the charges of subscriptions falling into a period per catalog service, most expensive first
+// @Tags subscriptions
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param user_id query []string false "User IDs, repeated or comma separated" collectionFormat(multi)
+// @Param service_id query string false "Catalog service ID"
+// @Param service_name query string false "Service name"
+// @Param service_name_match query string false "Service name matching; exact also matches catalog aliases" Enums(contains, exact)
+// @Param start_date query string false "Start of the period (MM-YYYY)"
+// @Param end_date query string false "End of the period (MM-YYYY)"
+// @Param start_from query string false "Earliest subscription start (MM-YYYY)"
+// @Param start_to query string false "Latest subscription start (MM-YYYY)"
+// @Param end_from query string false "Earliest subscription end (MM-YYYY)"
+// @Param end_to query string false "Latest subscription end (MM-YYYY)"
+// @Param active_at query string false "Month the subscription is active in (MM-YYYY)"
+// @Param price_min query int false "Minimum price per billing period"
+// @Param price_max query int false "Maximum price per billing period"
+// @Param open_ended query bool false "Only subscriptions without (true) or with (false) an end date"
+// @Param include_deleted query bool false "Include deleted subscriptions (admins only)"
+// @Param currency query string false "Currency to convert the costs into (ISO 4217)"
+// @Success 200 {object} models.ServiceCostResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /subscriptions/total-cost/by-service [get]
+func (h *SubscriptionHandler) GetCostByService(c *gin.Context) {
+	filter, err := parseSubscriptionFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	currency, err := parseCurrency(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	costs, err := h.service.GetCostByService(c.Request.Context(), filter, currency)
+	if err != nil {
+		switch errors.Cause(err) {
+		case service.ErrForbidden:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": auth.ReasonNotOwner})
+		case service.ErrAdminRequired:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": auth.ReasonMissingRole})
+		case service.ErrMissingExchangeRate:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, costs)
+}
+
+func parseSubscriptionFilter(c *gin.Context) (*models.SubscriptionFilter, error) {
 	var filter models.SubscriptionFilter
 
-	if userID := c.Query("user_id"); userID != "" {
-		id, err := uuid.Parse(userID)
+	userIDs, err := parseUserIDs(c)
+	if err != nil {
+		return nil, err
+	}
+	filter.UserIDs = userIDs
+
+	if value := c.Query("service_id"); value != "" {
+		serviceID, err := uuid.Parse(value)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
-			return
+			return nil, errors.New("invalid service id")
 		}
-		filter.UserID = &id
+		filter.ServiceID = &serviceID
 	}
 
 	if serviceName := c.Query("service_name"); serviceName != "" {
 		filter.ServiceName = &serviceName
 	}
 
-	if startDate := c.Query("start_date"); startDate != "" {
-		filter.StartDate = &startDate
+	filter.ServiceNameMatch = c.DefaultQuery("service_name_match", models.ServiceNameMatchContains)
+	if filter.ServiceNameMatch != models.ServiceNameMatchContains && filter.ServiceNameMatch != models.ServiceNameMatchExact {
+		return nil, errors.New("service_name_match must be exact or contains")
+	}
+
+	months := map[string]**time.Time{
+		"start_date": &filter.StartDate,
+		"end_date":   &filter.EndDate,
+		"start_from": &filter.StartFrom,
+		"start_to":   &filter.StartTo,
+		"end_from":   &filter.EndFrom,
+		"end_to":     &filter.EndTo,
+		"active_at":  &filter.ActiveAt,
+	}
+	for name, target := range months {
+		if value := c.Query(name); value != "" {
+			month, err := time.Parse("01-2006", value)
+			if err != nil {
+				return nil, errors.Errorf("%s must be in MM-YYYY format", name)
+			}
+			*target = &month
+		}
+	}
+
+	prices := map[string]**int{
+		"price_min": &filter.PriceMin,
+		"price_max": &filter.PriceMax,
+	}
+	for name, target := range prices {
+		if value := c.Query(name); value != "" {
+			price, err := strconv.Atoi(value)
+			if err != nil || price < 0 {
+				return nil, errors.Errorf("%s must be a non-negative integer", name)
+			}
+			*target = &price
+		}
 	}
 
-	if endDate := c.Query("end_date"); endDate != "" {
-		filter.EndDate = &endDate
+	if value := c.Query("open_ended"); value != "" {
+		openEnded, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("open_ended must be true or false")
+		}
+		filter.OpenEnded = &openEnded
 	}
 
-	totalCost, err := h.service.GetTotalCost(c.Request.Context(), &filter)
+	includeDeleted, err := parseIncludeDeleted(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return nil, err
+	}
+	filter.IncludeDeleted = includeDeleted
+
+	return &filter, nil
+}
+
+// parseUserIDs parses the user_id query parameters, which may be repeated or
+// hold comma separated IDs.
+func parseUserIDs(c *gin.Context) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for _, value := range c.QueryArray("user_id") {
+		for _, userID := range strings.Split(value, ",") {
+			if userID = strings.TrimSpace(userID); userID == "" {
+				continue
+			}
+			id, err := uuid.Parse(userID)
+			if err != nil {
+				return nil, errors.New("invalid user id")
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func parseIncludeDeleted(c *gin.Context) (bool, error) {
+	value := c.Query("include_deleted")
+	if value == "" {
+		return false, nil
+	}
+
+	includeDeleted, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New("include_deleted must be true or false")
+	}
+	return includeDeleted, nil
+}
+
+// parseCurrency returns the ISO 4217 currency requested with the currency
+// query parameter, or an empty string when none was.
+func parseCurrency(c *gin.Context) (string, error) {
+	var query struct {
+		Currency string `form:"currency" binding:"omitempty,iso4217"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		return "", errors.New("currency must be an ISO 4217 code")
+	}
+	return query.Currency, nil
+}
+
+func parsePageRequest(c *gin.Context) (*models.PageRequest, error) {
+	sort, order, err := parseSort(c)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.PageRequest{
+		Limit:  models.DefaultPageLimit,
+		Cursor: c.Query("cursor"),
+		Sort:   sort,
+		Order:  order,
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > models.MaxPageLimit {
+			return nil, errors.Errorf("limit must be between 1 and %d", models.MaxPageLimit)
+		}
+		page.Limit = value
+	}
+
+	return page, nil
+}
+
+// parseSort returns the sort field and order requested with the sort and
+// order query parameters, newest first by default.
+func parseSort(c *gin.Context) (string, string, error) {
+	sort := c.DefaultQuery("sort", models.SortByCreatedAt)
+	order := c.DefaultQuery("order", models.SortDesc)
+
+	switch sort {
+	case models.SortByCreatedAt, models.SortByPrice, models.SortByStartDate, models.SortByServiceName:
+	default:
+		return "", "", errors.New("invalid sort field")
+	}
+
+	if order != models.SortAsc && order != models.SortDesc {
+		return "", "", errors.New("order must be asc or desc")
 	}
 
-	c.JSON(http.StatusOK, models.TotalCostResponse{TotalCost: totalCost})
+	return sort, order, nil
 }
@@ -0,0 +1,170 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"subscription-service/internal/auth"
+	"subscription-service/internal/handlers"
+	"subscription-service/internal/middleware"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/service"
+	"subscription-service/internal/tenant"
+	"subscription-service/internal/testdb"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	testSecret   = "tenant-isolation-secret"
+	tenantHeader = "X-Tenant-ID"
+)
+
+// TestTenantIsolation checks that the subscriptions of one tenant cannot be
+// read, updated or deleted with credentials of another one, whatever tenant
+// the request names.
+func TestTenantIsolation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, jobs := testdb.Open(t)
+
+	subscriptions := repository.NewSubscriptionRepository(db)
+	users := repository.NewUserRepository(db)
+	subscriptionService := service.NewSubscriptionService(subscriptions, repository.NewServiceRepository(db), users,
+		repository.NewAuditRepository(db), repository.NewIdempotencyRepository(db), repository.NewOutboxRepository(db),
+		repository.NewTransactor(db), "RUB", time.Hour)
+	apiKeys := service.NewAPIKeyService(repository.NewAPIKeyRepository(db))
+
+	verifier, err := auth.NewVerifier(auth.VerifierConfig{HMACSecret: testSecret, AdminRole: string(auth.RoleAdmin)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionService)
+	router := gin.New()
+	v1 := router.Group("/api/v1")
+	v1.Use(middleware.Auth(verifier, apiKeys), middleware.Tenant(tenantHeader))
+	v1.GET("/subscriptions/:id", middleware.Authorize(auth.OpSubscriptionsGet), subscriptionHandler.GetSubscription)
+	v1.PUT("/subscriptions/:id", middleware.Authorize(auth.OpSubscriptionsUpdate), subscriptionHandler.UpdateSubscription)
+	v1.DELETE("/subscriptions/:id", middleware.Authorize(auth.OpSubscriptionsDelete), subscriptionHandler.DeleteSubscription)
+
+	tenantA := tenant.WithID(context.Background(), "tenant-a")
+	tenantB := tenant.WithID(context.Background(), "tenant-b")
+	sub := createSubscription(t, tenantB, users, subscriptions)
+
+	// Admins bound to a tenant are the most privileged principals that
+	// are still confined to it.
+	token := signToken(t, jwt.MapClaims{
+		"sub":    uuid.NewString(),
+		"tenant": "tenant-a",
+		"roles":  []string{string(auth.RoleAdmin)},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	})
+	key, err := apiKeys.IssueKey(tenantA, &models.IssueAPIKeyRequest{
+		Name:   "tenant a",
+		Scopes: []string{models.ScopeSubscriptionsRead, models.ScopeSubscriptionsWrite},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credentials := map[string]http.Header{
+		"token of tenant a":   {"Authorization": {"Bearer " + token}},
+		"api key of tenant a": {"X-API-Key": {key.Key}},
+	}
+	requests := []struct {
+		method string
+		body   string
+	}{
+		{method: http.MethodGet},
+		{method: http.MethodPut, body: `{"price": 999}`},
+		{method: http.MethodDelete},
+	}
+
+	for name, header := range credentials {
+		for _, req := range requests {
+			t.Run(name+"/"+req.method, func(t *testing.T) {
+				if code := serve(router, req.method, sub.ID, req.body, header, ""); code != http.StatusNotFound {
+					t.Errorf("status = %d, want %d", code, http.StatusNotFound)
+				}
+			})
+			t.Run(name+"/"+req.method+" naming tenant b", func(t *testing.T) {
+				if code := serve(router, req.method, sub.ID, req.body, header, "tenant-b"); code != http.StatusForbidden {
+					t.Errorf("status = %d, want %d", code, http.StatusForbidden)
+				}
+			})
+		}
+	}
+
+	// The jobs role sees every tenant, so it shows what the requests left
+	// behind, including deleted subscriptions.
+	var price int
+	var deleted bool
+	err = jobs.QueryRowContext(tenantB, "SELECT price, deleted_at IS NOT NULL FROM subscriptions WHERE id = $1", sub.ID).Scan(&price, &deleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price != sub.Price || deleted {
+		t.Errorf("subscription of tenant b was changed: price = %d, deleted = %v", price, deleted)
+	}
+}
+
+func createSubscription(t *testing.T, ctx context.Context, users repository.UserRepository, subscriptions repository.SubscriptionRepository) *models.Subscription {
+	t.Helper()
+
+	now := time.Now()
+	user := &models.User{ID: uuid.New(), CreatedAt: now, UpdatedAt: now}
+	if _, err := users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	sub := &models.Subscription{
+		ID:               uuid.New(),
+		ServiceName:      "Netflix",
+		Price:            100,
+		Currency:         "RUB",
+		UserID:           user.ID,
+		StartDate:        time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Status:           models.StatusActive,
+		BillingPeriod:    models.BillingMonthly,
+		BillingInterval:  1,
+		BillingAnchorDay: 1,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if err := subscriptions.Create(ctx, sub); err != nil {
+		t.Fatal(err)
+	}
+	return sub
+}
+
+func signToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func serve(router http.Handler, method string, id uuid.UUID, body string, header http.Header, tenantID string) int {
+	req := httptest.NewRequest(method, "/api/v1/subscriptions/"+id.String(), strings.NewReader(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if tenantID != "" {
+		req.Header.Set(tenantHeader, tenantID)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Code
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"net/http"
+	"subscription-service/internal/auth"
+	"subscription-service/internal/models"
+	"subscription-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+type UserHandler struct {
+	service       service.UserService
+	subscriptions service.SubscriptionService
+}
+
+func NewUserHandler(service service.UserService, subscriptions service.SubscriptionService) *UserHandler {
+	return &UserHandler{service: service, subscriptions: subscriptions}
+}
+
+// CreateUser godoc
+// @Summary Create a user
+// @Description Create a user; the id is generated unless given
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param request body models.CreateUserRequest true "User data"
+// @Success 201 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users [post]
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	var req models.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.service.CreateUser(c.Request.Context(), &req)
+	if err != nil {
+		if errors.Cause(err) == service.ErrUserConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// GetUser godoc
+// @Summary Get user by ID
+// @Description Get user details by ID
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/{id} [get]
+func (h *UserHandler) GetUser(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	user, err := h.service.GetUser(c.Request.Context(), id)
+	if err != nil {
+		if errors.Cause(err) == service.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateUser godoc
+// @Summary Update user
+// @Description Update user details; an empty email removes it
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "User ID"
+// @Param request body models.UpdateUserRequest true "User update data"
+// @Success 200 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/{id} [put]
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.service.UpdateUser(c.Request.Context(), id, &req)
+	if err != nil {
+		switch errors.Cause(err) {
+		case service.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		case service.ErrUserConflict:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteUser godoc
+// @Summary Delete user
+// @Description Delete a user. Depending on the configured policy, deleting a user with subscriptions is rejected, deletes them too or reassigns them to another user. Subscriptions deleted along with the user are kept until they are purged but cannot be restored.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "User ID"
+// @Param reassign_to query string false "User to reassign the subscriptions to under the reassign policy"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/{id} [delete]
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	var reassignTo *uuid.UUID
+	if value := c.Query("reassign_to"); value != "" {
+		target, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reassign_to user id"})
+			return
+		}
+		reassignTo = &target
+	}
+
+	if err := h.service.DeleteUser(c.Request.Context(), id, reassignTo); err != nil {
+		switch errors.Cause(err) {
+		case service.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		case service.ErrUserHasSubscriptions:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case service.ErrInvalidReassign:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user deleted successfully"})
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Description Get all users ordered by name
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Success 200 {array} models.User
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users [get]
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	users, err := h.service.ListUsers(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// ListUserSubscriptions godoc
+// @Summary List subscriptions of a user
+// @Description Get a page of the subscriptions of a user with the filtering and sorting of the subscription list
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "User ID"
+// @Param service_id query string false "Catalog service ID"
+// @Param service_name query string false "Service name"
+// @Param service_name_match query string false "Service name matching; exact also matches catalog aliases" Enums(contains, exact)
+// @Param start_date query string false "Start of the period (MM-YYYY)"
+// @Param end_date query string false "End of the period (MM-YYYY)"
+// @Param start_from query string false "Earliest subscription start (MM-YYYY)"
+// @Param start_to query string false "Latest subscription start (MM-YYYY)"
+// @Param end_from query string false "Earliest subscription end (MM-YYYY)"
+// @Param end_to query string false "Latest subscription end (MM-YYYY)"
+// @Param active_at query string false "Month the subscription is active in (MM-YYYY)"
+// @Param price_min query int false "Minimum price per billing period"
+// @Param price_max query int false "Maximum price per billing period"
+// @Param open_ended query bool false "Only subscriptions without (true) or with (false) an end date"
+// @Param include_deleted query bool false "Include deleted subscriptions (admins only)"
+// @Param limit query int false "Page size (1-100, default 20)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field" Enums(created_at, price, start_date, service_name)
+// @Param order query string false "Sort order" Enums(asc, desc)
+// @Success 200 {object} models.SubscriptionPage
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/{id}/subscriptions [get]
+func (h *UserHandler) ListUserSubscriptions(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	filter, err := parseSubscriptionFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.UserIDs = []uuid.UUID{id}
+
+	page, err := parsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.service.GetUser(c.Request.Context(), id); err != nil {
+		if errors.Cause(err) == service.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	subscriptions, err := h.subscriptions.ListSubscriptions(c.Request.Context(), filter, page)
+	if err != nil {
+		switch errors.Cause(err) {
+		case service.ErrForbidden:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": auth.ReasonNotOwner})
+		case service.ErrAdminRequired:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "reason": auth.ReasonMissingRole})
+		case service.ErrInvalidCursor:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, subscriptions)
+}
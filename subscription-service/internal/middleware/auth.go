@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"subscription-service/internal/auth"
+	"subscription-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Auth rejects requests that carry neither a valid API key in the X-API-Key
+// header nor a valid bearer token. The principal is handed to the handlers
+// through the request context. verifier may be nil when only API keys are
+// accepted.
+func Auth(verifier *auth.Verifier, keys service.APIKeyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := authenticate(c, verifier, keys)
+		if err != nil {
+			if errors.Cause(err) != auth.ErrInvalidToken && errors.Cause(err) != service.ErrInvalidAPIKey {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.Header("WWW-Authenticate", `Bearer realm="api"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), principal))
+		c.Next()
+	}
+}
+
+func authenticate(c *gin.Context, verifier *auth.Verifier, keys service.APIKeyService) (*auth.Principal, error) {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return keys.Authenticate(c.Request.Context(), strings.TrimSpace(key))
+	}
+
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil, errors.Wrap(auth.ErrInvalidToken, "missing bearer token or api key")
+	}
+	if verifier == nil {
+		return nil, errors.Wrap(auth.ErrInvalidToken, "bearer tokens are not accepted")
+	}
+
+	return verifier.Verify(strings.TrimSpace(token))
+}
+
+// Authorize rejects requests whose principal may not perform op according
+// to the access policy. Requests served without authentication pass.
+func Authorize(op auth.Operation) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := auth.FromContext(c.Request.Context())
+		if !ok {
+			c.Next()
+			return
+		}
+
+		if denial := auth.Authorize(principal, op); denial != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":     denial.Message,
+				"reason":    denial.Reason,
+				"operation": denial.Operation,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"subscription-service/internal/requestid"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the id of a request in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength caps ids supplied by clients.
+const maxRequestIDLength = 128
+
+// RequestID tags every request with the id sent by the client in the
+// X-Request-ID header or a generated one, and echoes it in the response.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = uuid.NewString()
+		}
+
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(requestid.WithID(c.Request.Context(), id))
+		c.Next()
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"subscription-service/internal/auth"
+	"subscription-service/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tenant resolves the tenant of a request and hands it to the repositories
+// through the request context. API keys and users bound to a tenant by their
+// token are always served from it and may only repeat it in header. Admins
+// choose the tenant with header; other users and requests without one fall
+// back to tenant.Default.
+func Tenant(header string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requested := c.GetHeader(header)
+		if requested != "" && !tenant.Valid(requested) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid tenant id"})
+			return
+		}
+
+		id := tenant.Default
+		principal, ok := auth.FromContext(c.Request.Context())
+		switch {
+		case ok && principal.TenantID != "":
+			if requested != "" && requested != principal.TenantID {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error":  "credentials are bound to another tenant",
+					"reason": auth.ReasonTenantMismatch,
+				})
+				return
+			}
+			id = principal.TenantID
+		case ok && !principal.Admin:
+			if requested != "" && requested != tenant.Default {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error":  "token is not bound to tenant " + requested,
+					"reason": auth.ReasonTenantMismatch,
+				})
+				return
+			}
+		case requested != "":
+			id = requested
+		}
+
+		c.Request = c.Request.WithContext(tenant.WithID(c.Request.Context(), id))
+		c.Next()
+	}
+}
@@ -0,0 +1,15 @@
+ALTER TABLE subscriptions
+    ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'active'
+    CHECK (status IN ('trial', 'active', 'paused', 'cancelled', 'expired'));
+
+CREATE INDEX idx_subscriptions_status ON subscriptions(status);
+
+CREATE TABLE subscription_pauses (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    start_month DATE NOT NULL,
+    end_month DATE NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_subscription_pauses_subscription_id ON subscription_pauses(subscription_id);
@@ -0,0 +1,12 @@
+CREATE TABLE subscription_prices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    price INTEGER NOT NULL CHECK (price > 0),
+    effective_from DATE NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (subscription_id, effective_from)
+);
+
+INSERT INTO subscription_prices (subscription_id, price, effective_from)
+SELECT id, price, date_trunc('month', start_date)
+FROM subscriptions;
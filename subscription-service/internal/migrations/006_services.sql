@@ -0,0 +1,24 @@
+CREATE TABLE services (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    category VARCHAR(255) NOT NULL DEFAULT '',
+    default_price INTEGER NULL CHECK (default_price > 0),
+    currency CHAR(3) NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_services_name ON services(lower(name));
+CREATE INDEX idx_services_category ON services(category);
+
+CREATE TABLE service_aliases (
+    service_id UUID NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    alias VARCHAR(255) NOT NULL,
+    PRIMARY KEY (service_id, alias)
+);
+
+CREATE UNIQUE INDEX idx_service_aliases_alias ON service_aliases(lower(alias));
+
+ALTER TABLE subscriptions ADD COLUMN service_id UUID NULL REFERENCES services(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_subscriptions_service_id ON subscriptions(service_id);
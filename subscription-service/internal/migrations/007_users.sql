@@ -0,0 +1,16 @@
+CREATE TABLE users (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    email VARCHAR(255) NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_users_email ON users(lower(email));
+
+-- Every user id already referenced by a subscription becomes a user.
+INSERT INTO users (id, created_at)
+SELECT user_id, MIN(created_at) FROM subscriptions GROUP BY user_id;
+
+ALTER TABLE subscriptions
+    ADD CONSTRAINT fk_subscriptions_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT;
@@ -0,0 +1,53 @@
+ALTER TABLE users ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default';
+ALTER TABLE services ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default';
+ALTER TABLE service_aliases ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default';
+ALTER TABLE subscriptions ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default';
+ALTER TABLE subscription_prices ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default';
+ALTER TABLE subscription_pauses ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default';
+
+CREATE INDEX idx_users_tenant_id ON users(tenant_id);
+CREATE INDEX idx_services_tenant_id ON services(tenant_id);
+CREATE INDEX idx_subscriptions_tenant_id ON subscriptions(tenant_id);
+
+-- Names only have to be unique within a tenant.
+DROP INDEX idx_users_email;
+CREATE UNIQUE INDEX idx_users_email ON users(tenant_id, lower(email));
+DROP INDEX idx_services_name;
+CREATE UNIQUE INDEX idx_services_name ON services(tenant_id, lower(name));
+DROP INDEX idx_service_aliases_alias;
+CREATE UNIQUE INDEX idx_service_aliases_alias ON service_aliases(tenant_id, lower(alias));
+
+-- Row-level security backs up the tenant conditions of the queries. The
+-- service sets app.tenant_id for each transaction; statements run outside a
+-- transaction see all tenants and rely on the conditions alone. Superusers
+-- and roles with BYPASSRLS are not subject to these policies, so the service
+-- has to connect as an ordinary role for them to take effect.
+ALTER TABLE users ENABLE ROW LEVEL SECURITY;
+ALTER TABLE users FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON users
+    USING (tenant_id = COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), tenant_id));
+
+ALTER TABLE services ENABLE ROW LEVEL SECURITY;
+ALTER TABLE services FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON services
+    USING (tenant_id = COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), tenant_id));
+
+ALTER TABLE service_aliases ENABLE ROW LEVEL SECURITY;
+ALTER TABLE service_aliases FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON service_aliases
+    USING (tenant_id = COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), tenant_id));
+
+ALTER TABLE subscriptions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE subscriptions FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON subscriptions
+    USING (tenant_id = COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), tenant_id));
+
+ALTER TABLE subscription_prices ENABLE ROW LEVEL SECURITY;
+ALTER TABLE subscription_prices FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON subscription_prices
+    USING (tenant_id = COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), tenant_id));
+
+ALTER TABLE subscription_pauses ENABLE ROW LEVEL SECURITY;
+ALTER TABLE subscription_pauses FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON subscription_pauses
+    USING (tenant_id = COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), tenant_id));
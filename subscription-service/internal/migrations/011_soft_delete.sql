@@ -0,0 +1,5 @@
+ALTER TABLE subscriptions ADD COLUMN deleted_at TIMESTAMP NULL;
+
+-- Deleted subscriptions are hidden by default and purged once their
+-- retention period has passed.
+CREATE INDEX idx_subscriptions_deleted_at ON subscriptions(deleted_at) WHERE deleted_at IS NOT NULL;
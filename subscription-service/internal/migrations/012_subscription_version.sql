@@ -0,0 +1,3 @@
+-- version is incremented by every change of a subscription and serves as its
+-- ETag, so that conditional requests can detect concurrent changes.
+ALTER TABLE subscriptions ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
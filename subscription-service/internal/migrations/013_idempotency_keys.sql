@@ -0,0 +1,20 @@
+-- Idempotency keys make retried subscription creations return the original
+-- subscription instead of creating another one. Keys are scoped to the
+-- tenant and the caller that sent them.
+CREATE TABLE idempotency_keys (
+    tenant_id VARCHAR(63) NOT NULL DEFAULT 'default',
+    actor VARCHAR(64) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    response JSONB NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (tenant_id, actor, key)
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+
+ALTER TABLE idempotency_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE idempotency_keys FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON idempotency_keys
+    USING (tenant_id = COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), tenant_id));
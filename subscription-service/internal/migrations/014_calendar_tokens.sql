@@ -0,0 +1,7 @@
+-- Calendar tokens give access to the charges feed of a user without further
+-- authentication, which calendar apps do not support. Only their hashes are
+-- stored; tokens are unique across tenants, so a token alone identifies the
+-- tenant of its feed.
+ALTER TABLE users ADD COLUMN calendar_token_hash CHAR(64) NULL;
+
+CREATE UNIQUE INDEX idx_users_calendar_token_hash ON users(calendar_token_hash);
@@ -0,0 +1,23 @@
+-- The outbox holds domain events written in the transaction of the change
+-- they are about until they have been dispatched to every sink, so that
+-- committed changes are never left unpublished. Sent events are kept for a
+-- while for inspection.
+CREATE TABLE outbox_events (
+    id UUID PRIMARY KEY,
+    tenant_id VARCHAR(63) NOT NULL DEFAULT 'default',
+    event_type VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_error TEXT NULL,
+    sent_at TIMESTAMP NULL
+);
+
+CREATE INDEX idx_outbox_events_due ON outbox_events(next_attempt_at) WHERE sent_at IS NULL;
+CREATE INDEX idx_outbox_events_sent_at ON outbox_events(sent_at) WHERE sent_at IS NOT NULL;
+
+ALTER TABLE outbox_events ENABLE ROW LEVEL SECURITY;
+ALTER TABLE outbox_events FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON outbox_events
+    USING (tenant_id = COALESCE(NULLIF(current_setting('app.tenant_id', true), ''), tenant_id));
@@ -0,0 +1,9 @@
+-- Prices are recorded together with their currency, so that changing the
+-- currency of a subscription does not reinterpret its earlier prices.
+ALTER TABLE subscription_prices ADD COLUMN currency CHAR(3);
+
+UPDATE subscription_prices sp SET currency = s.currency
+FROM subscriptions s
+WHERE s.id = sp.subscription_id;
+
+ALTER TABLE subscription_prices ALTER COLUMN currency SET NOT NULL;
@@ -0,0 +1,8 @@
+-- API keys belong to the tenant they were issued for and only give access to
+-- its data. Keys are looked up by hash before the tenant of a request is
+-- known, so the table has no row-level security; the queries of the key
+-- administration are restricted to the tenant instead.
+ALTER TABLE api_keys ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ALTER COLUMN tenant_id DROP DEFAULT;
+
+CREATE INDEX idx_api_keys_tenant_id ON api_keys(tenant_id);
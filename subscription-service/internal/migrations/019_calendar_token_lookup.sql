@@ -0,0 +1,14 @@
+-- Calendar feeds are requested before their tenant is known, so their tokens
+-- move out of users, which is subject to row-level security, into a table
+-- without it. Like API keys, tokens are looked up by hash alone; setting and
+-- removing them is restricted to the tenant of the user.
+CREATE TABLE calendar_tokens (
+    token_hash CHAR(64) PRIMARY KEY,
+    tenant_id VARCHAR(63) NOT NULL,
+    user_id UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO calendar_tokens (token_hash, tenant_id, user_id)
+SELECT calendar_token_hash, tenant_id, id FROM users WHERE calendar_token_hash IS NOT NULL;
+
+ALTER TABLE users DROP COLUMN calendar_token_hash;
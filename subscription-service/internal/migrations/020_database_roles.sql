@@ -0,0 +1,39 @@
+-- The service serves requests as subscription_app, which is subject to
+-- row-level security, and runs the background jobs, which work across
+-- tenants, as subscription_jobs, which bypasses it. Neither role owns the
+-- tables. The roles are created without passwords; deployments set them.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'subscription_app') THEN
+        CREATE ROLE subscription_app LOGIN NOSUPERUSER NOBYPASSRLS;
+    END IF;
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'subscription_jobs') THEN
+        CREATE ROLE subscription_jobs LOGIN NOSUPERUSER BYPASSRLS;
+    END IF;
+END
+$$;
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO subscription_app, subscription_jobs;
+GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO subscription_app, subscription_jobs;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public
+    GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO subscription_app, subscription_jobs;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public
+    GRANT USAGE, SELECT ON SEQUENCES TO subscription_app, subscription_jobs;
+
+-- The policies fail closed: the service sets app.tenant_id before every
+-- statement, empty when it serves no tenant, and sessions that never set it
+-- get an error instead of the rows of every tenant.
+DO $$
+DECLARE
+    table_name TEXT;
+BEGIN
+    FOREACH table_name IN ARRAY ARRAY[
+        'users', 'services', 'service_aliases', 'subscriptions', 'subscription_prices',
+        'subscription_pauses', 'audit_log', 'idempotency_keys', 'webhook_endpoints',
+        'webhook_deliveries', 'outbox_events'
+    ] LOOP
+        EXECUTE format('DROP POLICY tenant_isolation ON %I', table_name);
+        EXECUTE format('CREATE POLICY tenant_isolation ON %I USING (tenant_id = current_setting(''app.tenant_id''))', table_name);
+    END LOOP;
+END
+$$;
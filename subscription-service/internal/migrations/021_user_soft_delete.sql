@@ -0,0 +1,7 @@
+-- Deleted subscriptions keep referencing their user until they are purged,
+-- so deleted users are only marked as such and removed by the purge once
+-- none of their subscriptions are left. They free their email right away.
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP NULL;
+
+DROP INDEX idx_users_email;
+CREATE UNIQUE INDEX idx_users_email ON users(tenant_id, lower(email)) WHERE deleted_at IS NULL;
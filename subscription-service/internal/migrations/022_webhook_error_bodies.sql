@@ -0,0 +1,5 @@
+-- Failed deliveries no longer keep the responses of endpoints, which could
+-- be used to read what the service reaches. Scrub those stored before.
+UPDATE webhook_deliveries
+SET last_error = regexp_replace(last_error, '^endpoint responded with ([0-9]{3}) .*$', 'endpoint responded with status \1')
+WHERE last_error LIKE 'endpoint responded with %';
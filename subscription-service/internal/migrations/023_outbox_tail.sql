@@ -0,0 +1,3 @@
+-- Every instance of the service follows the events appended to the outbox
+-- to feed its event streams, whichever instance dispatches them.
+CREATE INDEX idx_outbox_events_appended ON outbox_events(created_at, id);
@@ -0,0 +1,8 @@
+// Package migrations holds the SQL migrations of the database, which are
+// applied in the order of their file names.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scopes grant API keys access to groups of endpoints.
+const (
+	ScopeSubscriptionsRead  = "subscriptions:read"
+	ScopeSubscriptionsWrite = "subscriptions:write"
+	ScopeReportsRead        = "reports:read"
+	ScopeUsersRead          = "users:read"
+	ScopeUsersWrite         = "users:write"
+	ScopeCatalogRead        = "catalog:read"
+	ScopeCatalogWrite       = "catalog:write"
+	ScopeAuditRead          = "audit:read"
+	ScopeWebhooksManage     = "webhooks:manage"
+	// ScopeAdmin grants managing API keys.
+	ScopeAdmin = "admin"
+)
+
+// APIKey authenticates service-to-service callers of the tenant it was
+// issued for. Only a hash of the key is stored; Prefix identifies the key in
+// listings and logs.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	TenantID   string     `json:"tenant_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type IssueAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required,min=1,dive,oneof=subscriptions:read subscriptions:write reports:read users:read users:write catalog:read catalog:write audit:read webhooks:manage admin"`
+	// ExpiresAt is optional; keys without it never expire.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// IssuedAPIKey carries the plain key, which is only ever shown once.
+type IssuedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditAction string
+
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditPause   AuditAction = "pause"
+	AuditResume  AuditAction = "resume"
+	AuditCancel  AuditAction = "cancel"
+	AuditRestore AuditAction = "restore"
+	AuditPurge   AuditAction = "purge"
+)
+
+// AuditEntitySubscription is the entity type of audit entries of
+// subscriptions.
+const AuditEntitySubscription = "subscription"
+
+// FieldChange is the value of a field before and after a change. Old is null
+// for created entities, New for deleted ones.
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// AuditEntry records a change of an entity. Actor is user:<id> or
+// api_key:<id> for authenticated requests and anonymous otherwise. Changes
+// holds the fields whose values differ, keyed by their JSON names.
+type AuditEntry struct {
+	ID         int64                  `json:"id"`
+	EntityType string                 `json:"entity_type"`
+	EntityID   uuid.UUID              `json:"entity_id"`
+	Action     AuditAction            `json:"action"`
+	Actor      string                 `json:"actor"`
+	RequestID  *string                `json:"request_id,omitempty"`
+	Changes    map[string]FieldChange `json:"changes"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 1000
+)
+
+// AuditFilter selects audit entries. From and To bound the time of the
+// entries inclusively.
+type AuditFilter struct {
+	EntityID *uuid.UUID
+	Actor    string
+	From     *time.Time
+	To       *time.Time
+	Limit    int
+}
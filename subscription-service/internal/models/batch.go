@@ -0,0 +1,77 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+type BatchMode string
+
+const (
+	// BatchAtomic applies all operations of a batch or none of them.
+	BatchAtomic BatchMode = "atomic"
+	// BatchBestEffort applies each operation on its own, so failed
+	// operations do not keep the others from being applied.
+	BatchBestEffort BatchMode = "best_effort"
+)
+
+type BatchOp string
+
+const (
+	BatchCreate BatchOp = "create"
+	BatchUpdate BatchOp = "update"
+	BatchDelete BatchOp = "delete"
+)
+
+// BatchOperation is one operation of a batch. Create carries the new
+// subscription of create operations, Update the changes of update
+// operations, which like delete operations name their subscription by ID.
+// Version makes updates and deletes conditional like If-Match does.
+type BatchOperation struct {
+	Op      BatchOp                    `json:"op"`
+	ID      *uuid.UUID                 `json:"id,omitempty"`
+	Version *int                       `json:"version,omitempty"`
+	Create  *CreateSubscriptionRequest `json:"create,omitempty"`
+	Update  *UpdateSubscriptionRequest `json:"update,omitempty"`
+}
+
+// BatchRequest lists operations to apply in order. Mode defaults to
+// atomic. Operations are validated one by one so that errors can be
+// reported by their index.
+type BatchRequest struct {
+	Mode       BatchMode        `json:"mode,omitempty" binding:"omitempty,oneof=atomic best_effort"`
+	Operations []BatchOperation `json:"operations" binding:"required,min=1,max=100"`
+}
+
+type BatchItemStatus string
+
+const (
+	BatchItemApplied BatchItemStatus = "applied"
+	BatchItemFailed  BatchItemStatus = "failed"
+	// BatchItemRolledBack marks operations of an atomic batch that
+	// succeeded but were undone because another operation failed.
+	BatchItemRolledBack BatchItemStatus = "rolled_back"
+	// BatchItemSkipped marks operations of an atomic batch that were not
+	// attempted because an earlier operation failed.
+	BatchItemSkipped BatchItemStatus = "skipped"
+)
+
+// BatchItemResult is the outcome of the operation at Index. Code is the
+// HTTP status the operation would have had as a request of its own. Err is
+// the error of failed operations, which handlers turn into Code and Error.
+type BatchItemResult struct {
+	Index        int             `json:"index"`
+	Op           BatchOp         `json:"op"`
+	Status       BatchItemStatus `json:"status"`
+	Code         int             `json:"code,omitempty"`
+	ID           *uuid.UUID      `json:"id,omitempty"`
+	Subscription *Subscription   `json:"subscription,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	Err          error           `json:"-"`
+}
+
+type BatchResponse struct {
+	Mode    BatchMode          `json:"mode"`
+	Applied int                `json:"applied"`
+	Failed  int                `json:"failed"`
+	Results []*BatchItemResult `json:"results"`
+}
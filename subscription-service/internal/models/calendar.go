@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// CalendarToken is the secret of the charges feed of a user. It is only
+// returned when it is issued; URL is the path of the feed including it.
+type CalendarToken struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// ChargeSeries are the recurring charges of a subscription, from First on
+// up to Until. Until is nil for subscriptions without an end date.
+type ChargeSeries struct {
+	Subscription *Subscription
+	First        time.Time
+	Until        *time.Time
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultMinorUnits is the number of decimal places of most ISO 4217
+// currencies. Prices are stored in minor units, e.g. kopecks or cents.
+const DefaultMinorUnits = 2
+
+// currencyMinorUnits lists the currencies whose minor unit differs from
+// DefaultMinorUnits.
+var currencyMinorUnits = map[string]int{
+	"BHD": 3,
+	"CLP": 0,
+	"IQD": 3,
+	"ISK": 0,
+	"JOD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"LYD": 3,
+	"OMR": 3,
+	"PYG": 0,
+	"TND": 3,
+	"UGX": 0,
+	"VND": 0,
+}
+
+// MinorUnits returns the number of decimal places of a currency.
+func MinorUnits(currency string) int {
+	if units, ok := currencyMinorUnits[currency]; ok {
+		return units
+	}
+	return DefaultMinorUnits
+}
+
+// CurrenciesWithMinorUnits returns the currencies whose minor unit differs
+// from DefaultMinorUnits.
+func CurrenciesWithMinorUnits() map[string]int {
+	units := make(map[string]int, len(currencyMinorUnits))
+	for currency, unit := range currencyMinorUnits {
+		units[currency] = unit
+	}
+	return units
+}
+
+// ExchangeRate is the value of one unit of BaseCurrency in QuoteCurrency
+// from Month on until the next rate of the pair.
+type ExchangeRate struct {
+	ID            uuid.UUID `json:"id"`
+	BaseCurrency  string    `json:"base_currency"`
+	QuoteCurrency string    `json:"quote_currency"`
+	Month         time.Time `json:"month"`
+	Rate          float64   `json:"rate"`
+}
+
+type ExchangeRateInput struct {
+	BaseCurrency  string  `json:"base_currency" yaml:"base_currency" binding:"required,iso4217"`
+	QuoteCurrency string  `json:"quote_currency" yaml:"quote_currency" binding:"required,iso4217"`
+	Month         string  `json:"month" yaml:"month" binding:"required"`
+	Rate          float64 `json:"rate" yaml:"rate" binding:"required,gt=0"`
+}
+
+type SetExchangeRatesRequest struct {
+	Rates []*ExchangeRateInput `json:"rates" yaml:"rates" binding:"required,dive"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EventType string
+
+const (
+	EventSubscriptionCreated EventType = "subscription.created"
+	EventSubscriptionUpdated EventType = "subscription.updated"
+	EventSubscriptionDeleted EventType = "subscription.deleted"
+	// EventSubscriptionRenewing announces the next charge of a subscription
+	// ahead of time.
+	EventSubscriptionRenewing EventType = "subscription.renewing"
+)
+
+// Event is a domain event about a subscription, as published to webhooks
+// and the other sinks. Sinks may receive an event more than once; its ID
+// tells duplicates apart.
+type Event struct {
+	ID        uuid.UUID `json:"id"`
+	Type      EventType `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      EventData `json:"data"`
+}
+
+// EventData is the subscription an event is about, as it is after the
+// change or, for deleted subscriptions, as it was before. ChargeDate is the
+// date of the announced charge of renewal notices.
+type EventData struct {
+	Subscription *Subscription `json:"subscription"`
+	ChargeDate   *time.Time    `json:"charge_date,omitempty"`
+}
+
+// OutboxEvent is an event recorded in the outbox in the transaction of the
+// change it is about, together with the tenant of the change. It stays in
+// the outbox until every sink has received it; Attempts counts the failed
+// dispatches.
+type OutboxEvent struct {
+	Event
+	TenantID string `json:"tenant_id"`
+	Attempts int    `json:"-"`
+}
+
+// EventFilter selects the events of an event stream by the subscription they
+// are about. Service names match when they contain ServiceName, ignoring
+// case.
+type EventFilter struct {
+	UserIDs     []uuid.UUID
+	ServiceName *string
+}
@@ -0,0 +1,17 @@
+package models
+
+type ExportFormat string
+
+const (
+	ExportCSV    ExportFormat = "csv"
+	ExportNDJSON ExportFormat = "ndjson"
+)
+
+// ExportColumns are the columns of CSV exports. Those shared with
+// CreateSubscriptionRequest hold values in the same form, so exports can be
+// imported again.
+var ExportColumns = []string{
+	"id", "service_name", "service_id", "price", "currency", "user_id", "start_date", "end_date", "status",
+	"billing_period", "billing_interval", "billing_anchor_day", "next_billing_date", "created_at", "updated_at",
+	"deleted_at", "version",
+}
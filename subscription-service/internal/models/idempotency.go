@@ -0,0 +1,21 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// IdempotencyKeyHeader carries the idempotency key of a request.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyKey remembers a request sent with an Idempotency-Key header.
+// RequestHash identifies the request the key was first used with, Response
+// holds the subscription it created.
+type IdempotencyKey struct {
+	Key         string
+	Actor       string
+	RequestHash string
+	Response    json.RawMessage
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+type ImportFormat string
+
+const (
+	ImportCSV    ImportFormat = "csv"
+	ImportNDJSON ImportFormat = "ndjson"
+)
+
+const MaxImportRows = 10000
+
+// ImportOptions describe an upload of subscriptions. Mapping maps the JSON
+// names of the fields of CreateSubscriptionRequest to the CSV columns or
+// NDJSON keys holding them; unmapped fields are read from the column or key
+// of the same name. DryRun only validates the rows.
+type ImportOptions struct {
+	Format  ImportFormat
+	Mapping map[string]string
+	DryRun  bool
+}
+
+// ImportRowResult reports on the row with the given 1-based number, not
+// counting the CSV header. ID is the id of the subscription created from
+// the row.
+type ImportRowResult struct {
+	Row   int        `json:"row"`
+	Valid bool       `json:"valid"`
+	Error string     `json:"error,omitempty"`
+	ID    *uuid.UUID `json:"id,omitempty"`
+}
+
+// ImportReport reports on every row of an upload. Imported is the number
+// of subscriptions created, which is zero for dry runs and for uploads with
+// invalid rows.
+type ImportReport struct {
+	DryRun   bool               `json:"dry_run"`
+	Rows     int                `json:"rows"`
+	Valid    int                `json:"valid"`
+	Invalid  int                `json:"invalid"`
+	Imported int                `json:"imported"`
+	Results  []*ImportRowResult `json:"results"`
+}
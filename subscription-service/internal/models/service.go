@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Service is a catalog entry subscriptions are grouped by. Subscriptions
+// created with the name or one of the aliases of a service are linked to it
+// and carry its canonical name. DefaultPrice is in minor units of Currency.
+type Service struct {
+	ID           uuid.UUID `json:"id"`
+	Name         string    `json:"name"`
+	Aliases      []string  `json:"aliases"`
+	Category     string    `json:"category"`
+	DefaultPrice *int      `json:"default_price,omitempty"`
+	Currency     *string   `json:"currency,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type CreateServiceRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	Aliases      []string `json:"aliases,omitempty"`
+	Category     string   `json:"category,omitempty"`
+	DefaultPrice *int     `json:"default_price,omitempty" binding:"omitempty,min=1"`
+	Currency     *string  `json:"currency,omitempty" binding:"omitempty,iso4217"`
+}
+
+// UpdateServiceRequest changes the given fields of a service. Aliases, when
+// given, replace all aliases of the service.
+type UpdateServiceRequest struct {
+	Name         *string   `json:"name,omitempty" binding:"omitempty,min=1"`
+	Aliases      *[]string `json:"aliases,omitempty"`
+	Category     *string   `json:"category,omitempty"`
+	DefaultPrice *int      `json:"default_price,omitempty" binding:"omitempty,min=1"`
+	Currency     *string   `json:"currency,omitempty" binding:"omitempty,iso4217"`
+}
+
+// ServiceCost sums the charges of the subscriptions of one service. Service
+// names that are not in the catalog are reported with a nil ServiceID.
+type ServiceCost struct {
+	ServiceID   *uuid.UUID `json:"service_id,omitempty"`
+	ServiceName string     `json:"service_name"`
+	Category    string     `json:"category"`
+	Amount      int        `json:"amount"`
+}
+
+type ServiceCostResponse struct {
+	Services  []*ServiceCost `json:"services"`
+	TotalCost int            `json:"total_cost"`
+	Currency  string         `json:"currency"`
+}
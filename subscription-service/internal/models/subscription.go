@@ -6,39 +6,199 @@ import (
 	"github.com/google/uuid"
 )
 
+type SubscriptionStatus string
+
+const (
+	StatusTrial     SubscriptionStatus = "trial"
+	StatusActive    SubscriptionStatus = "active"
+	StatusPaused    SubscriptionStatus = "paused"
+	StatusCancelled SubscriptionStatus = "cancelled"
+	StatusExpired   SubscriptionStatus = "expired"
+)
+
+type BillingPeriod string
+
+const (
+	BillingWeekly    BillingPeriod = "weekly"
+	BillingMonthly   BillingPeriod = "monthly"
+	BillingQuarterly BillingPeriod = "quarterly"
+	BillingYearly    BillingPeriod = "yearly"
+	BillingCustom    BillingPeriod = "custom"
+)
+
+// Subscription prices are amounts charged once per billing period, in minor
+// units of Currency, an ISO 4217 code. BillingInterval is the length of the
+// period in weeks for weekly billing and in months otherwise.
+// BillingAnchorDay is the ISO weekday (1 is Monday) charges fall on for
+// weekly billing and the day of the month otherwise, moved to the last day
+// of shorter months. ServiceID links the subscription to the catalog service
+// its name resolved to, whose canonical name it then carries. DeletedAt is
+// only set for deleted subscriptions, which can be restored until they are
+// purged. Version is incremented by every change and identifies the state
+// of the subscription in ETags.
 type Subscription struct {
-	ID          uuid.UUID  `json:"id" db:"id"`
-	ServiceName string     `json:"service_name" db:"service_name"`
-	Price       int        `json:"price" db:"price"`
-	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
-	StartDate   time.Time  `json:"start_date" db:"start_date"`
-	EndDate     *time.Time `json:"end_date,omitempty" db:"end_date"`
-	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	ID               uuid.UUID          `json:"id" db:"id"`
+	ServiceName      string             `json:"service_name" db:"service_name"`
+	ServiceID        *uuid.UUID         `json:"service_id,omitempty" db:"service_id"`
+	Price            int                `json:"price" db:"price"`
+	Currency         string             `json:"currency" db:"currency"`
+	UserID           uuid.UUID          `json:"user_id" db:"user_id"`
+	StartDate        time.Time          `json:"start_date" db:"start_date"`
+	EndDate          *time.Time         `json:"end_date,omitempty" db:"end_date"`
+	Status           SubscriptionStatus `json:"status" db:"status"`
+	BillingPeriod    BillingPeriod      `json:"billing_period" db:"billing_period"`
+	BillingInterval  int                `json:"billing_interval" db:"billing_interval"`
+	BillingAnchorDay int                `json:"billing_anchor_day" db:"billing_anchor_day"`
+	NextBillingDate  *time.Time         `json:"next_billing_date,omitempty" db:"-"`
+	CreatedAt        time.Time          `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time          `json:"updated_at" db:"updated_at"`
+	DeletedAt        *time.Time         `json:"deleted_at,omitempty" db:"deleted_at"`
+	Version          int                `json:"version" db:"version"`
 }
 
+// CreateSubscriptionRequest may leave out the price when the service name
+// resolves to a catalog service with a default price, which then comes with
+// the default currency of the service.
 type CreateSubscriptionRequest struct {
-	ServiceName string    `json:"service_name" binding:"required"`
-	Price       int       `json:"price" binding:"required,min=1"`
-	UserID      uuid.UUID `json:"user_id" binding:"required"`
-	StartDate   string    `json:"start_date" binding:"required"`
-	EndDate     *string   `json:"end_date,omitempty"`
+	ServiceName   string    `json:"service_name" binding:"required"`
+	Price         int       `json:"price,omitempty" binding:"omitempty,min=1"`
+	Currency      string    `json:"currency,omitempty" binding:"omitempty,iso4217"`
+	UserID        uuid.UUID `json:"user_id" binding:"required"`
+	StartDate     string    `json:"start_date" binding:"required"`
+	EndDate       *string   `json:"end_date,omitempty"`
+	Status        string    `json:"status,omitempty" binding:"omitempty,oneof=trial active"`
+	BillingPeriod string    `json:"billing_period,omitempty" binding:"omitempty,oneof=weekly monthly quarterly yearly custom"`
+	// BillingInterval is the number of months of a custom billing period.
+	BillingInterval int `json:"billing_interval,omitempty" binding:"omitempty,min=1,max=120"`
+	// BillingAnchorDay defaults to the first day of the month, or for weekly
+	// billing to the weekday the subscription starts on.
+	BillingAnchorDay int `json:"billing_anchor_day,omitempty" binding:"omitempty,min=1,max=31"`
 }
 
 type UpdateSubscriptionRequest struct {
 	ServiceName *string `json:"service_name,omitempty"`
-	Price       *int    `json:"price,omitempty"`
-	StartDate   *string `json:"start_date,omitempty"`
-	EndDate     *string `json:"end_date,omitempty"`
+	Price       *int    `json:"price,omitempty" binding:"omitempty,min=1"`
+	// PriceEffectiveFrom is the month (MM-YYYY) a new price applies from.
+	// It defaults to the current month.
+	PriceEffectiveFrom *string `json:"price_effective_from,omitempty"`
+	Currency           *string `json:"currency,omitempty" binding:"omitempty,iso4217"`
+	StartDate          *string `json:"start_date,omitempty"`
+	EndDate            *string `json:"end_date,omitempty"`
+	BillingPeriod      *string `json:"billing_period,omitempty" binding:"omitempty,oneof=weekly monthly quarterly yearly custom"`
+	BillingInterval    *int    `json:"billing_interval,omitempty" binding:"omitempty,min=1,max=120"`
+	BillingAnchorDay   *int    `json:"billing_anchor_day,omitempty" binding:"omitempty,min=1,max=31"`
+}
+
+// SubscriptionChange is a subscription before and after a change applied to
+// many subscriptions at once.
+type SubscriptionChange struct {
+	Before *Subscription
+	After  *Subscription
+}
+
+// PriceChange is an entry of the price history of a subscription. The price
+// in Currency applies from EffectiveFrom until the next change.
+type PriceChange struct {
+	ID             uuid.UUID `json:"id"`
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	Price          int       `json:"price"`
+	Currency       string    `json:"currency"`
+	EffectiveFrom  time.Time `json:"effective_from"`
+	CreatedAt      time.Time `json:"created_at"`
 }
 
+const (
+	ServiceNameMatchContains = "contains"
+	ServiceNameMatchExact    = "exact"
+)
+
+// SubscriptionFilter narrows down the subscriptions seen by the list and cost
+// endpoints. StartDate and EndDate bound the period of interest: only
+// subscriptions overlapping it match, and costs are calculated within it.
+// All dates are months, i.e. the first day of the month.
 type SubscriptionFilter struct {
-	UserID      *uuid.UUID `form:"user_id"`
-	ServiceName *string    `form:"service_name"`
-	StartDate   *string    `form:"start_date"`
-	EndDate     *string    `form:"end_date"`
+	UserIDs          []uuid.UUID `form:"user_id"`
+	ServiceID        *uuid.UUID  `form:"service_id"`
+	ServiceName      *string     `form:"service_name"`
+	ServiceNameMatch string      `form:"service_name_match"`
+	StartDate        *time.Time  `form:"start_date"`
+	EndDate          *time.Time  `form:"end_date"`
+	StartFrom        *time.Time  `form:"start_from"`
+	StartTo          *time.Time  `form:"start_to"`
+	EndFrom          *time.Time  `form:"end_from"`
+	EndTo            *time.Time  `form:"end_to"`
+	ActiveAt         *time.Time  `form:"active_at"`
+	PriceMin         *int        `form:"price_min"`
+	PriceMax         *int        `form:"price_max"`
+	OpenEnded        *bool       `form:"open_ended"`
+	// IncludeDeleted also selects deleted subscriptions, which only admins
+	// may ask for.
+	IncludeDeleted bool `form:"include_deleted"`
+}
+
+const (
+	SortByCreatedAt   = "created_at"
+	SortByPrice       = "price"
+	SortByStartDate   = "start_date"
+	SortByServiceName = "service_name"
+
+	SortAsc  = "asc"
+	SortDesc = "desc"
+
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+type PageRequest struct {
+	Limit  int
+	Cursor string
+	Sort   string
+	Order  string
+}
+
+// PageCursor is the keyset position of the last subscription on a page.
+// It is handed to clients as an opaque token and is only valid for the
+// sort field and order it was issued for.
+type PageCursor struct {
+	Sort  string    `json:"s"`
+	Order string    `json:"o"`
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+// ListOptions select the subscriptions of a listing. A zero Limit lists
+// all of them.
+type ListOptions struct {
+	Limit int
+	Sort  string
+	Order string
+	After *PageCursor
+}
+
+type SubscriptionPage struct {
+	Subscriptions []*Subscription `json:"subscriptions"`
+	NextCursor    string          `json:"next_cursor,omitempty"`
+	Total         int             `json:"total"`
 }
 
 type TotalCostResponse struct {
-	TotalCost int `json:"total_cost"`
+	TotalCost int    `json:"total_cost"`
+	Currency  string `json:"currency"`
+}
+
+// CostBreakdownLine sums the charges of one service and user falling into
+// Month. Subscriptions of a catalog service are reported under its canonical
+// name.
+type CostBreakdownLine struct {
+	Month       string     `json:"month"`
+	ServiceID   *uuid.UUID `json:"service_id,omitempty"`
+	ServiceName string     `json:"service_name"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Amount      int        `json:"amount"`
+}
+
+type CostBreakdownResponse struct {
+	Lines     []*CostBreakdownLine `json:"lines"`
+	TotalCost int                  `json:"total_cost"`
+	Currency  string               `json:"currency"`
 }
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserDeletePolicy decides what happens to the subscriptions of a user that
+// is deleted.
+type UserDeletePolicy string
+
+const (
+	// UserDeleteReject refuses to delete users that still have subscriptions.
+	UserDeleteReject UserDeletePolicy = "reject"
+	// UserDeleteCascade deletes the subscriptions together with the user.
+	// Like other deleted subscriptions they are kept until they are purged.
+	UserDeleteCascade UserDeletePolicy = "cascade"
+	// UserDeleteReassign moves the subscriptions to another user.
+	UserDeleteReassign UserDeletePolicy = "reassign"
+)
+
+type User struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Email     *string   `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CreateUserRequest creates a user with a generated id unless ID is given,
+// which allows registering users whose ids are already known elsewhere.
+type CreateUserRequest struct {
+	ID    *uuid.UUID `json:"id,omitempty"`
+	Name  string     `json:"name" binding:"required"`
+	Email *string    `json:"email,omitempty" binding:"omitempty,email"`
+}
+
+// UpdateUserRequest changes the given fields of a user. An empty email
+// removes it.
+type UpdateUserRequest struct {
+	Name  *string `json:"name,omitempty" binding:"omitempty,min=1"`
+	Email *string `json:"email,omitempty" binding:"omitempty,email|len=0"`
+}
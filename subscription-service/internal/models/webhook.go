@@ -0,0 +1,102 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "pending"
+	DeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	// DeliveryFailed deliveries gave up after the last retry. They can
+	// still be redelivered by hand.
+	DeliveryFailed WebhookDeliveryStatus = "failed"
+)
+
+const (
+	DefaultDeliveryLimit = 50
+	MaxDeliveryLimit     = 500
+)
+
+// WebhookEndpoint receives the events of its tenant whose types are listed
+// in EventTypes while it is active. Its secret signs the payloads and is
+// only returned when the endpoint is created.
+type WebhookEndpoint struct {
+	ID         uuid.UUID `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"-"`
+	EventTypes []string  `json:"event_types"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// CreatedWebhookEndpoint is a newly registered endpoint together with its
+// secret.
+type CreatedWebhookEndpoint struct {
+	WebhookEndpoint
+	Secret string `json:"secret"`
+}
+
+// CreateWebhookEndpointRequest registers an endpoint. A secret is generated
+// unless one is given.
+type CreateWebhookEndpointRequest struct {
+	URL        string   `json:"url" binding:"required,url,max=2048"`
+	Secret     *string  `json:"secret,omitempty" binding:"omitempty,min=16,max=255"`
+	EventTypes []string `json:"event_types" binding:"required,min=1,dive,oneof=subscription.created subscription.updated subscription.deleted subscription.renewing"`
+}
+
+// UpdateWebhookEndpointRequest changes the given fields of an endpoint.
+type UpdateWebhookEndpointRequest struct {
+	URL        *string  `json:"url,omitempty" binding:"omitempty,url,max=2048"`
+	EventTypes []string `json:"event_types,omitempty" binding:"omitempty,min=1,dive,oneof=subscription.created subscription.updated subscription.deleted subscription.renewing"`
+	Active     *bool    `json:"active,omitempty"`
+}
+
+// WebhookDelivery is the delivery of an event to an endpoint and the outcome
+// of its latest attempt. Pending deliveries are attempted at NextAttemptAt.
+type WebhookDelivery struct {
+	ID             uuid.UUID             `json:"id"`
+	EndpointID     uuid.UUID             `json:"endpoint_id"`
+	EventID        uuid.UUID             `json:"event_id"`
+	EventType      EventType             `json:"event_type"`
+	Payload        json.RawMessage       `json:"payload" swaggertype:"object"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	NextAttemptAt  *time.Time            `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time            `json:"last_attempt_at,omitempty"`
+	ResponseStatus *int                  `json:"response_status,omitempty"`
+	LastError      *string               `json:"last_error,omitempty"`
+	CreatedAt      time.Time             `json:"created_at"`
+}
+
+// DueWebhookDelivery is a delivery claimed for an attempt together with the
+// endpoint it goes to.
+type DueWebhookDelivery struct {
+	Delivery *WebhookDelivery
+	TenantID string
+	URL      string
+	Secret   string
+}
+
+// WebhookAttempt is the outcome of an attempt to deliver an event.
+// ResponseStatus is zero when no response was received.
+type WebhookAttempt struct {
+	Status         WebhookDeliveryStatus
+	NextAttemptAt  *time.Time
+	ResponseStatus int
+	Error          string
+}
+
+// WebhookRetryPolicy spaces the attempts of a delivery out exponentially:
+// the nth retry waits Base * 2^(n-1), at most Max. Deliveries fail after
+// MaxAttempts attempts.
+type WebhookRetryPolicy struct {
+	MaxAttempts int
+	Base        time.Duration
+	Max         time.Duration
+}
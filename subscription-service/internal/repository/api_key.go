@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"subscription-service/internal/models"
+	"subscription-service/internal/tenant"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *models.APIKey, hash string) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.APIKey, error)
+	GetByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	List(ctx context.Context) ([]*models.APIKey, error)
+	Revoke(ctx context.Context, id uuid.UUID) error
+	Touch(ctx context.Context, id uuid.UUID) error
+}
+
+const apiKeyColumns = "k.id, k.tenant_id, k.name, k.prefix, k.scopes, k.expires_at, k.last_used_at, k.revoked_at, k.created_at"
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var key models.APIKey
+	err := row.Scan(
+		&key.ID, &key.TenantID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt, &key.CreatedAt,
+	)
+	return &key, err
+}
+
+// apiKeyRepo manages the keys of the tenant of the context. Only GetByHash
+// and Touch, which authenticate requests, find the keys of all tenants.
+type apiKeyRepo struct {
+	db *sql.DB
+}
+
+func NewAPIKeyRepository(db *sql.DB) APIKeyRepository {
+	return &apiKeyRepo{db: db}
+}
+
+func (r *apiKeyRepo) Create(ctx context.Context, key *models.APIKey, hash string) error {
+	query := `
+        INSERT INTO api_keys (id, tenant_id, name, prefix, key_hash, scopes, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    `
+
+	key.TenantID = tenant.FromContext(ctx)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		key.ID, key.TenantID, key.Name, key.Prefix, hash, pq.Array(key.Scopes), key.ExpiresAt, key.CreatedAt)
+	return errors.Wrap(err, "failed to create api key")
+}
+
+func (r *apiKeyRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys k WHERE k.id = $1 AND k.tenant_id = $2"
+
+	key, err := scanAPIKey(conn(ctx, r.db).QueryRowContext(ctx, query, id, tenant.FromContext(ctx)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return key, errors.Wrap(err, "failed to get api key by id")
+}
+
+// GetByHash finds the key with the given hash whatever its tenant.
+func (r *apiKeyRepo) GetByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys k WHERE k.key_hash = $1"
+
+	key, err := scanAPIKey(conn(ctx, r.db).QueryRowContext(ctx, query, hash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return key, errors.Wrap(err, "failed to get api key by hash")
+}
+
+func (r *apiKeyRepo) List(ctx context.Context) ([]*models.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys k WHERE k.tenant_id = $1 ORDER BY k.created_at DESC, k.id"
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list api keys")
+	}
+	defer rows.Close()
+
+	var keys []*models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan api key")
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, errors.Wrap(rows.Err(), "failed to iterate api keys")
+}
+
+func (r *apiKeyRepo) Revoke(ctx context.Context, id uuid.UUID) error {
+	query := "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $1) WHERE id = $2 AND tenant_id = $3"
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, time.Now(), id, tenant.FromContext(ctx))
+	return errors.Wrap(err, "failed to revoke api key")
+}
+
+// Touch records that a key was used. To spare a write per request, the time
+// is only updated once a minute.
+func (r *apiKeyRepo) Touch(ctx context.Context, id uuid.UUID) error {
+	query := `
+        UPDATE api_keys SET last_used_at = $1
+        WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < $1 - interval '1 minute')
+    `
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, time.Now(), id)
+	return errors.Wrap(err, "failed to record api key use")
+}
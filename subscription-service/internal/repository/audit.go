@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"subscription-service/internal/models"
+	"subscription-service/internal/tenant"
+
+	"github.com/pkg/errors"
+)
+
+// AuditRepository appends to and reads the audit log. Entries are never
+// changed once written.
+type AuditRepository interface {
+	Append(ctx context.Context, entry *models.AuditEntry) error
+	List(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEntry, error)
+}
+
+const auditColumns = "al.id, al.entity_type, al.entity_id, al.action, al.actor, al.request_id, al.changes, al.created_at"
+
+func scanAuditEntry(row rowScanner) (*models.AuditEntry, error) {
+	var entry models.AuditEntry
+	var changes []byte
+	err := row.Scan(
+		&entry.ID, &entry.EntityType, &entry.EntityID, &entry.Action, &entry.Actor, &entry.RequestID, &changes, &entry.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, errors.Wrap(json.Unmarshal(changes, &entry.Changes), "failed to decode audit changes")
+}
+
+type auditRepo struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) AuditRepository {
+	return &auditRepo{db: db}
+}
+
+// Append writes entry to the audit log of the tenant of ctx and fills in its
+// id and time.
+func (r *auditRepo) Append(ctx context.Context, entry *models.AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode audit changes")
+	}
+
+	query := `
+        INSERT INTO audit_log (tenant_id, entity_type, entity_id, action, actor, request_id, changes)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING id, created_at
+    `
+
+	err = conn(ctx, r.db).QueryRowContext(ctx, query,
+		tenant.FromContext(ctx), entry.EntityType, entry.EntityID, entry.Action, entry.Actor, entry.RequestID, changes,
+	).Scan(&entry.ID, &entry.CreatedAt)
+	return errors.Wrap(err, "failed to append audit entry")
+}
+
+// List returns the matching entries, newest first.
+func (r *auditRepo) List(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEntry, error) {
+	b := newFilterBuilder().forTenant(ctx, "al.tenant_id")
+	if filter.EntityID != nil {
+		b.add("al.entity_id = %s", *filter.EntityID)
+	}
+	if filter.Actor != "" {
+		b.add("al.actor = %s", filter.Actor)
+	}
+	if filter.From != nil {
+		b.add("al.created_at >= %s", *filter.From)
+	}
+	if filter.To != nil {
+		b.add("al.created_at <= %s", *filter.To)
+	}
+
+	query := "SELECT " + auditColumns + " FROM audit_log al" + b.where() +
+		" ORDER BY al.created_at DESC, al.id DESC LIMIT " + b.arg(filter.Limit)
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, b.args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list audit entries")
+	}
+	defer rows.Close()
+
+	var entries []*models.AuditEntry
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan audit entry")
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, errors.Wrap(rows.Err(), "failed to iterate audit entries")
+}
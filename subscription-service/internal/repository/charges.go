@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"subscription-service/internal/models"
+)
+
+// chargesQuery selects one row per charge of a subscription of the tenant of
+// ctx matching filter that falls into the filter period, with the price in
+// effect in the month of the charge converted from the currency it was
+// recorded in into currency. Charges before the first recorded price are
+// made at that price. Charges in months in which the subscription was
+// paused are skipped. An unbounded period starts with each subscription and
+// ends with the current month, which also caps subscriptions without an end
+// date.
+//
+// Weekly subscriptions are charged every week on their anchor weekday from
+// the start date on, all others every billing interval months on their
+// anchor day from the start month on.
+//
+// Prices in another currency are converted with the latest rate of the
+// currency pair known for the month, using the inverse pair as a fallback.
+// The amount is NULL when neither is known.
+//
+// Subscriptions of a catalog service are reported with its canonical name
+// and category.
+//
+// The rows have the columns subscription_id, service_id, service_name,
+// category, user_id, charge_date, month, currency and amount.
+func chargesQuery(ctx context.Context, filter *models.SubscriptionFilter, currency string) (string, []interface{}) {
+	b := newFilterBuilder(filter.StartDate, filter.EndDate, currency, models.MinorUnits(currency)).
+		forTenant(ctx, "s.tenant_id").
+		apply(filter)
+	b.add("ch.charge_date >= COALESCE($1::date, s.start_date)")
+	b.add(`NOT EXISTS (
+            SELECT 1 FROM subscription_pauses pz
+            WHERE pz.subscription_id = s.id
+                AND pz.start_month <= ch.month
+                AND (pz.end_month IS NULL OR pz.end_month >= ch.month)
+        )`)
+
+	query := `
+        SELECT s.id AS subscription_id, s.service_id, COALESCE(sv.name, s.service_name) AS service_name,
+            COALESCE(sv.category, '') AS category, s.user_id, ch.charge_date, ch.month, p.currency,
+            CASE WHEN p.currency = $3 THEN p.price
+                ELSE ROUND(p.price * r.rate * power(10::numeric, $4 - ` + minorUnitsExpr("p.currency") + `))
+            END AS amount
+        FROM subscriptions s
+        LEFT JOIN services sv ON sv.id = s.service_id
+        CROSS JOIN LATERAL (
+            SELECT COALESCE($2::timestamp, date_trunc('month', LOCALTIMESTAMP)) + interval '1 month' - interval '1 day' AS period_end
+        ) pe
+        CROSS JOIN LATERAL (
+            SELECT d.charge_date, date_trunc('month', d.charge_date)::date AS month
+            FROM (
+                SELECT CASE WHEN s.billing_period = 'weekly' THEN g::date
+                    ELSE (g + (LEAST(s.billing_anchor_day, EXTRACT(DAY FROM g + interval '1 month' - interval '1 day')::int) - 1) * interval '1 day')::date
+                END AS charge_date
+                FROM generate_series(
+                    CASE WHEN s.billing_period = 'weekly'
+                        THEN s.start_date + (s.billing_anchor_day - EXTRACT(ISODOW FROM s.start_date)::int + 7) % 7
+                        ELSE date_trunc('month', s.start_date::timestamp)
+                    END,
+                    LEAST(COALESCE(date_trunc('month', s.end_date::timestamp) + interval '1 month' - interval '1 day', pe.period_end), pe.period_end),
+                    CASE WHEN s.billing_period = 'weekly'
+                        THEN interval '7 days'
+                        ELSE make_interval(months => s.billing_interval)
+                    END
+                ) AS g
+            ) d
+        ) ch
+        CROSS JOIN LATERAL (
+            SELECT ` + priceInEffect("price", "ch.month") + ` AS price, ` + priceInEffect("currency", "ch.month") + ` AS currency
+        ) p
+        CROSS JOIN LATERAL (
+            SELECT COALESCE((
+                SELECT er.rate FROM exchange_rates er
+                WHERE er.base_currency = p.currency AND er.quote_currency = $3 AND er.month <= ch.month
+                ORDER BY er.month DESC
+                LIMIT 1
+            ), (
+                SELECT 1 / er.rate FROM exchange_rates er
+                WHERE er.base_currency = $3 AND er.quote_currency = p.currency AND er.month <= ch.month
+                ORDER BY er.month DESC
+                LIMIT 1
+            )) AS rate
+        ) r
+    ` + b.where()
+
+	return query, b.args
+}
+
+// minorUnitsExpr returns an SQL expression for the number of decimal places
+// of the currency in column.
+func minorUnitsExpr(column string) string {
+	units := models.CurrenciesWithMinorUnits()
+	currencies := make([]string, 0, len(units))
+	for currency := range units {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	expr := "CASE " + column
+	for _, currency := range currencies {
+		expr += fmt.Sprintf(" WHEN '%s' THEN %d", currency, units[currency])
+	}
+	return expr + fmt.Sprintf(" ELSE %d END", models.DefaultMinorUnits)
+}
@@ -0,0 +1,94 @@
+package repository_test
+
+import (
+	"context"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/tenant"
+	"subscription-service/internal/testdb"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func month(t *testing.T, value string) *time.Time {
+	t.Helper()
+	m, err := time.Parse("01-2006", value)
+	if err != nil {
+		t.Fatalf("invalid month %q: %v", value, err)
+	}
+	return &m
+}
+
+func TestGetTotalCost(t *testing.T) {
+	db, _ := testdb.Open(t)
+	users := repository.NewUserRepository(db)
+	subscriptions := repository.NewSubscriptionRepository(db)
+	ctx := tenant.WithID(context.Background(), tenant.Default)
+
+	// Every subscription costs 100 a month and is charged on the first, so
+	// the cost is 100 per month it is active in during 2024.
+	tests := []struct {
+		name  string
+		start string
+		end   string
+		want  int
+	}{
+		{name: "fully inside", start: "03-2024", end: "05-2024", want: 300},
+		{name: "open-ended", start: "06-2024", want: 700},
+		{name: "open-ended before period", start: "06-2023", want: 1200},
+		{name: "overlapping period start", start: "10-2023", end: "02-2024", want: 200},
+		{name: "overlapping period end", start: "11-2024", end: "03-2025", want: 200},
+		{name: "covering period", start: "01-2023", end: "12-2025", want: 1200},
+		{name: "ending in first month", start: "06-2023", end: "01-2024", want: 100},
+		{name: "starting in last month", start: "12-2024", end: "06-2025", want: 100},
+		{name: "single month", start: "07-2024", end: "07-2024", want: 100},
+		{name: "ending before period", start: "01-2023", end: "12-2023", want: 0},
+		{name: "starting after period", start: "01-2025", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			user := &models.User{ID: uuid.New(), CreatedAt: now, UpdatedAt: now}
+			if _, err := users.Create(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+
+			sub := &models.Subscription{
+				ID:               uuid.New(),
+				ServiceName:      "Netflix",
+				Price:            100,
+				Currency:         "RUB",
+				UserID:           user.ID,
+				StartDate:        *month(t, tt.start),
+				Status:           models.StatusActive,
+				BillingPeriod:    models.BillingMonthly,
+				BillingInterval:  1,
+				BillingAnchorDay: 1,
+				CreatedAt:        now,
+				UpdatedAt:        now,
+			}
+			if tt.end != "" {
+				sub.EndDate = month(t, tt.end)
+			}
+			if err := subscriptions.Create(ctx, sub); err != nil {
+				t.Fatal(err)
+			}
+
+			filter := &models.SubscriptionFilter{
+				UserIDs:   []uuid.UUID{user.ID},
+				StartDate: month(t, "01-2024"),
+				EndDate:   month(t, "12-2024"),
+			}
+			got, err := subscriptions.GetTotalCost(ctx, filter, "RUB")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("GetTotalCost() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
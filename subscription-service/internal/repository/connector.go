@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"subscription-service/internal/tenant"
+
+	"github.com/pkg/errors"
+)
+
+// NewConnector wraps connector so that every statement runs with
+// app.tenant_id set to the tenant of its context, which the row-level
+// security policies of the tenant tables compare against. Statements whose
+// context carries no tenant run with an empty app.tenant_id and see no
+// tenant rows. The setting is only changed when it differs from the one of
+// the previous statement on the same connection.
+//
+// connector must return connections and statements implementing the context
+// variants of the driver interfaces, as those of lib/pq do.
+func NewConnector(connector driver.Connector) driver.Connector {
+	return &tenantConnector{Connector: connector}
+}
+
+type tenantConnector struct {
+	driver.Connector
+}
+
+func (c *tenantConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tenantConn{Conn: conn}, nil
+}
+
+// tenantConn is a connection that sets app.tenant_id before each statement.
+// tenantID is the value it was last set to; it is nil while unknown, such as
+// before the first statement or after a rollback undid the setting.
+type tenantConn struct {
+	driver.Conn
+	tenantID *string
+}
+
+func (c *tenantConn) setTenant(ctx context.Context) error {
+	id, _ := tenant.ID(ctx)
+	if c.tenantID != nil && *c.tenantID == id {
+		return nil
+	}
+
+	c.tenantID = nil
+	args := []driver.NamedValue{{Ordinal: 1, Value: id}}
+	if _, err := c.Conn.(driver.ExecerContext).ExecContext(ctx, "SELECT set_config('app.tenant_id', $1, false)", args); err != nil {
+		return errors.Wrap(err, "failed to set tenant")
+	}
+	c.tenantID = &id
+	return nil
+}
+
+func (c *tenantConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.setTenant(ctx); err != nil {
+		return nil, err
+	}
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+func (c *tenantConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.setTenant(ctx); err != nil {
+		return nil, err
+	}
+	return c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+// PrepareContext prepares statements whose executions set the tenant of
+// their own context.
+func (c *tenantConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &tenantStmt{Stmt: stmt, conn: c}, nil
+}
+
+func (c *tenantConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *tenantConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &tenantTx{Tx: tx, conn: c}, nil
+}
+
+func (c *tenantConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// tenantTx forgets the tenant of its connection when the transaction is
+// rolled back, which undoes the settings changed within it.
+type tenantTx struct {
+	driver.Tx
+	conn *tenantConn
+}
+
+func (t *tenantTx) Commit() error {
+	err := t.Tx.Commit()
+	if err != nil {
+		t.conn.tenantID = nil
+	}
+	return err
+}
+
+func (t *tenantTx) Rollback() error {
+	t.conn.tenantID = nil
+	return t.Tx.Rollback()
+}
+
+type tenantStmt struct {
+	driver.Stmt
+	conn *tenantConn
+}
+
+func (s *tenantStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if err := s.conn.setTenant(ctx); err != nil {
+		return nil, err
+	}
+	return s.Stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+}
+
+func (s *tenantStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if err := s.conn.setTenant(ctx); err != nil {
+		return nil, err
+	}
+	return s.Stmt.(driver.StmtQueryContext).QueryContext(ctx, args)
+}
@@ -0,0 +1,61 @@
+package repository_test
+
+import (
+	"context"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/tenant"
+	"subscription-service/internal/testdb"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestRowLevelSecurity checks that statements without tenant conditions only
+// see the rows of the tenant of their context, and none without one, unless
+// they run as the jobs role.
+func TestRowLevelSecurity(t *testing.T) {
+	db, jobs := testdb.Open(t)
+	users := repository.NewUserRepository(db)
+
+	for _, id := range []string{"tenant-a", "tenant-a", "tenant-b"} {
+		now := time.Now()
+		user := &models.User{ID: uuid.New(), CreatedAt: now, UpdatedAt: now}
+		if _, err := users.Create(tenant.WithID(context.Background(), id), user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		jobs bool
+		want int
+	}{
+		{name: "tenant a", ctx: tenant.WithID(context.Background(), "tenant-a"), want: 2},
+		{name: "tenant b", ctx: tenant.WithID(context.Background(), "tenant-b"), want: 1},
+		{name: "unknown tenant", ctx: tenant.WithID(context.Background(), "tenant-c"), want: 0},
+		{name: "no tenant", ctx: context.Background(), want: 0},
+		{name: "jobs", ctx: context.Background(), jobs: true, want: 3},
+	}
+
+	// The cases share connections, so each one also checks that the tenant
+	// of the previous one does not linger.
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := db
+			if tt.jobs {
+				conn = jobs
+			}
+
+			var got int
+			if err := conn.QueryRowContext(tt.ctx, "SELECT count(*) FROM users").Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("users = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
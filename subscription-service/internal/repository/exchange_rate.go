@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"subscription-service/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+// ErrMissingExchangeRate is returned when a cost calculation needs a
+// conversion for which no exchange rate is known.
+var ErrMissingExchangeRate = errors.New("missing exchange rate")
+
+type ExchangeRateRepository interface {
+	Upsert(ctx context.Context, rate *models.ExchangeRate) error
+	List(ctx context.Context, baseCurrency, quoteCurrency string) ([]*models.ExchangeRate, error)
+}
+
+type exchangeRateRepo struct {
+	db *sql.DB
+}
+
+func NewExchangeRateRepository(db *sql.DB) ExchangeRateRepository {
+	return &exchangeRateRepo{db: db}
+}
+
+func (r *exchangeRateRepo) Upsert(ctx context.Context, rate *models.ExchangeRate) error {
+	query := `
+        INSERT INTO exchange_rates (id, base_currency, quote_currency, month, rate)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (base_currency, quote_currency, month)
+        DO UPDATE SET rate = EXCLUDED.rate, updated_at = NOW()
+        RETURNING id
+    `
+
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		rate.ID, rate.BaseCurrency, rate.QuoteCurrency, rate.Month, rate.Rate).Scan(&rate.ID)
+	return errors.Wrap(err, "failed to upsert exchange rate")
+}
+
+func (r *exchangeRateRepo) List(ctx context.Context, baseCurrency, quoteCurrency string) ([]*models.ExchangeRate, error) {
+	b := newFilterBuilder()
+	if baseCurrency != "" {
+		b.add("base_currency = %s", baseCurrency)
+	}
+	if quoteCurrency != "" {
+		b.add("quote_currency = %s", quoteCurrency)
+	}
+
+	query := "SELECT id, base_currency, quote_currency, month, rate FROM exchange_rates" +
+		b.where() + " ORDER BY base_currency, quote_currency, month"
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, b.args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list exchange rates")
+	}
+	defer rows.Close()
+
+	var rates []*models.ExchangeRate
+	for rows.Next() {
+		var rate models.ExchangeRate
+		if err := rows.Scan(&rate.ID, &rate.BaseCurrency, &rate.QuoteCurrency, &rate.Month, &rate.Rate); err != nil {
+			return nil, errors.Wrap(err, "failed to scan exchange rate")
+		}
+		rates = append(rates, &rate)
+	}
+
+	return rates, errors.Wrap(rows.Err(), "failed to iterate exchange rates")
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"subscription-service/internal/models"
+	"subscription-service/internal/tenant"
+)
+
+// filterBuilder collects WHERE conditions together with their positional
+// arguments. Its apply method is shared by every query that accepts a
+// models.SubscriptionFilter, with the subscriptions table aliased as s, so
+// they all agree on the meaning of the filter.
+type filterBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+func newFilterBuilder(args ...interface{}) *filterBuilder {
+	return &filterBuilder{args: args}
+}
+
+// arg registers a query argument and returns its placeholder.
+func (b *filterBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// add appends a condition whose %s verbs are replaced by the placeholders of
+// the given values. Indexed verbs such as %[1]s reuse a placeholder.
+func (b *filterBuilder) add(condition string, values ...interface{}) {
+	placeholders := make([]interface{}, len(values))
+	for i, value := range values {
+		placeholders[i] = b.arg(value)
+	}
+	b.conditions = append(b.conditions, fmt.Sprintf(condition, placeholders...))
+}
+
+// forTenant restricts the query to the rows of the tenant of ctx, whose
+// tenant id is in column.
+func (b *filterBuilder) forTenant(ctx context.Context, column string) *filterBuilder {
+	b.add(column+" = %s", tenant.FromContext(ctx))
+	return b
+}
+
+func (b *filterBuilder) apply(filter *models.SubscriptionFilter) *filterBuilder {
+	if !filter.IncludeDeleted {
+		b.add("s.deleted_at IS NULL")
+	}
+
+	if len(filter.UserIDs) == 1 {
+		b.add("s.user_id = %s", filter.UserIDs[0])
+	} else if len(filter.UserIDs) > 1 {
+		ids := make([]string, len(filter.UserIDs))
+		for i, id := range filter.UserIDs {
+			ids[i] = id.String()
+		}
+		b.add("s.user_id = ANY(%s::uuid[])", "{"+strings.Join(ids, ",")+"}")
+	}
+
+	if filter.ServiceID != nil {
+		b.add("s.service_id = %s", *filter.ServiceID)
+	}
+
+	// An exact service name also matches the aliases of a catalog service.
+	if filter.ServiceName != nil {
+		if filter.ServiceNameMatch == models.ServiceNameMatchExact {
+			b.add(`(lower(s.service_name) = lower(%[1]s) OR s.service_id IN (
+                SELECT a.service_id FROM service_aliases a WHERE lower(a.alias) = lower(%[1]s) AND a.tenant_id = s.tenant_id
+            ))`, *filter.ServiceName)
+		} else {
+			b.add("s.service_name ILIKE %s", "%"+*filter.ServiceName+"%")
+		}
+	}
+
+	if filter.StartDate != nil {
+		b.add("(s.end_date IS NULL OR s.end_date >= %s)", *filter.StartDate)
+	}
+
+	if filter.EndDate != nil {
+		b.add("s.start_date <= %s", *filter.EndDate)
+	}
+
+	if filter.StartFrom != nil {
+		b.add("s.start_date >= %s", *filter.StartFrom)
+	}
+
+	if filter.StartTo != nil {
+		b.add("s.start_date <= %s", *filter.StartTo)
+	}
+
+	if filter.EndFrom != nil {
+		b.add("s.end_date >= %s", *filter.EndFrom)
+	}
+
+	if filter.EndTo != nil {
+		b.add("s.end_date <= %s", *filter.EndTo)
+	}
+
+	if filter.ActiveAt != nil {
+		b.add("(s.start_date <= %[1]s AND (s.end_date IS NULL OR s.end_date >= %[1]s))", *filter.ActiveAt)
+	}
+
+	if filter.PriceMin != nil {
+		b.add(priceInEffect("price", currentMonth)+" >= %s", *filter.PriceMin)
+	}
+
+	if filter.PriceMax != nil {
+		b.add(priceInEffect("price", currentMonth)+" <= %s", *filter.PriceMax)
+	}
+
+	if filter.OpenEnded != nil {
+		if *filter.OpenEnded {
+			b.add("s.end_date IS NULL")
+		} else {
+			b.add("s.end_date IS NOT NULL")
+		}
+	}
+
+	return b
+}
+
+// where renders the collected conditions as a WHERE clause.
+func (b *filterBuilder) where() string {
+	if len(b.conditions) == 0 {
+		return " WHERE TRUE"
+	}
+	return " WHERE " + strings.Join(b.conditions, " AND ")
+}
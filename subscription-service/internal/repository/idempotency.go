@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"subscription-service/internal/models"
+	"subscription-service/internal/tenant"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IdempotencyRepository stores the idempotency keys of each tenant. Expired
+// keys are deleted for all tenants at once, which takes a connection that
+// bypasses row-level security.
+type IdempotencyRepository interface {
+	Reserve(ctx context.Context, key *models.IdempotencyKey) (*models.IdempotencyKey, error)
+	Complete(ctx context.Context, key *models.IdempotencyKey) error
+	DeleteExpired(ctx context.Context, before time.Time) (int, error)
+}
+
+type idempotencyRepo struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) IdempotencyRepository {
+	return &idempotencyRepo{db: db}
+}
+
+// Reserve records key for the tenant of ctx unless it is already in use, in
+// which case it returns the stored key instead. Expired keys count as
+// unused and are taken over. A concurrent Reserve of the same key waits for
+// the transaction of the first to finish.
+func (r *idempotencyRepo) Reserve(ctx context.Context, key *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	query := `
+        INSERT INTO idempotency_keys (tenant_id, actor, key, request_hash, created_at, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (tenant_id, actor, key) DO UPDATE
+            SET request_hash = EXCLUDED.request_hash, response = NULL,
+                created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+            WHERE idempotency_keys.expires_at <= $7
+    `
+	result, err := conn(ctx, r.db).ExecContext(ctx, query,
+		tenant.FromContext(ctx), key.Actor, key.Key, key.RequestHash, key.CreatedAt, key.ExpiresAt, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to reserve idempotency key")
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected > 0 {
+		return nil, errors.Wrap(err, "failed to reserve idempotency key")
+	}
+
+	query = `
+        SELECT key, actor, request_hash, response, created_at, expires_at FROM idempotency_keys
+        WHERE tenant_id = $1 AND actor = $2 AND key = $3
+    `
+	var stored models.IdempotencyKey
+	var response []byte
+	err = conn(ctx, r.db).QueryRowContext(ctx, query, tenant.FromContext(ctx), key.Actor, key.Key).Scan(
+		&stored.Key, &stored.Actor, &stored.RequestHash, &response, &stored.CreatedAt, &stored.ExpiresAt,
+	)
+	stored.Response = response
+	return &stored, errors.Wrap(err, "failed to get idempotency key")
+}
+
+// Complete stores the response to the request key was reserved for.
+func (r *idempotencyRepo) Complete(ctx context.Context, key *models.IdempotencyKey) error {
+	query := "UPDATE idempotency_keys SET response = $1 WHERE tenant_id = $2 AND actor = $3 AND key = $4"
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, []byte(key.Response), tenant.FromContext(ctx), key.Actor, key.Key)
+	return errors.Wrap(err, "failed to complete idempotency key")
+}
+
+// DeleteExpired deletes the keys of all tenants that expired before the
+// given time and returns their number.
+func (r *idempotencyRepo) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	result, err := conn(ctx, r.db).ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= $1", before)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to delete expired idempotency keys")
+	}
+
+	deleted, err := result.RowsAffected()
+	return int(deleted), errors.Wrap(err, "failed to delete expired idempotency keys")
+}
@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"subscription-service/internal/models"
+	"subscription-service/internal/tenant"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// OutboxRepository stores domain events until they are dispatched. Events
+// are appended for the tenant of the context and dispatched and listed for
+// all tenants at once, which takes a connection that bypasses row-level
+// security.
+type OutboxRepository interface {
+	Append(ctx context.Context, event *models.Event) error
+	ClaimDue(ctx context.Context, lease time.Duration, limit int) ([]*models.OutboxEvent, error)
+	ListAppended(ctx context.Context, after time.Time, afterID uuid.UUID, limit int) ([]*models.OutboxEvent, error)
+	ListLatest(ctx context.Context, limit int) ([]*models.OutboxEvent, error)
+	MarkSent(ctx context.Context, id uuid.UUID) error
+	RecordFailure(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time, reason string) error
+	DeleteSent(ctx context.Context, before time.Time) (int, error)
+}
+
+type outboxRepo struct {
+	db *sql.DB
+}
+
+func NewOutboxRepository(db *sql.DB) OutboxRepository {
+	return &outboxRepo{db: db}
+}
+
+// Append adds an event to the outbox. It has to be called within the
+// transaction of the change the event is about, so that the event is kept
+// if and only if the change is.
+func (r *outboxRepo) Append(ctx context.Context, event *models.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode event")
+	}
+
+	query := `
+        INSERT INTO outbox_events (id, tenant_id, event_type, payload, created_at, next_attempt_at)
+        VALUES ($1, $2, $3, $4, $5, $5)
+    `
+
+	_, err = conn(ctx, r.db).ExecContext(ctx, query, event.ID, tenant.FromContext(ctx), event.Type, payload, event.CreatedAt)
+	return errors.Wrap(err, "failed to append event to outbox")
+}
+
+// ClaimDue claims up to limit unsent events that are due, of all tenants,
+// by postponing them by lease, and returns them in the order they were
+// appended. Other instances skip them until then, so that the lease has to
+// outlast the dispatch; events whose dispatch was cut short are claimed
+// again once it is over.
+func (r *outboxRepo) ClaimDue(ctx context.Context, lease time.Duration, limit int) ([]*models.OutboxEvent, error) {
+	now := time.Now()
+	query := `
+        UPDATE outbox_events SET next_attempt_at = $1
+        WHERE id IN (
+            SELECT id FROM outbox_events
+            WHERE sent_at IS NULL AND next_attempt_at <= $2
+            ORDER BY created_at
+            LIMIT $3
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING tenant_id, payload, attempts
+    `
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, now.Add(lease), now, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to claim outbox events")
+	}
+	events, err := scanOutboxEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+	return events, nil
+}
+
+// ListAppended returns up to limit events of all tenants, sent or not, that
+// were appended after the event appended at after with the id afterID, in
+// the order they were appended. Events appended at the same time are
+// ordered by id.
+func (r *outboxRepo) ListAppended(ctx context.Context, after time.Time, afterID uuid.UUID, limit int) ([]*models.OutboxEvent, error) {
+	query := `
+        SELECT tenant_id, payload, attempts FROM outbox_events
+        WHERE (created_at, id) > ($1, $2)
+        ORDER BY created_at, id
+        LIMIT $3
+    `
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, after, afterID, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list outbox events")
+	}
+	return scanOutboxEvents(rows)
+}
+
+// ListLatest returns the last limit events appended for all tenants, sent
+// or not, in the order they were appended.
+func (r *outboxRepo) ListLatest(ctx context.Context, limit int) ([]*models.OutboxEvent, error) {
+	query := `
+        SELECT tenant_id, payload, attempts FROM (
+            SELECT tenant_id, payload, attempts, created_at, id FROM outbox_events
+            ORDER BY created_at DESC, id DESC
+            LIMIT $1
+        ) latest
+        ORDER BY created_at, id
+    `
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list outbox events")
+	}
+	return scanOutboxEvents(rows)
+}
+
+// scanOutboxEvents reads and closes rows of the tenant, payload and attempts
+// of events.
+func scanOutboxEvents(rows *sql.Rows) ([]*models.OutboxEvent, error) {
+	defer rows.Close()
+
+	var events []*models.OutboxEvent
+	for rows.Next() {
+		var event models.OutboxEvent
+		var payload []byte
+		if err := rows.Scan(&event.TenantID, &payload, &event.Attempts); err != nil {
+			return nil, errors.Wrap(err, "failed to scan outbox event")
+		}
+		if err := json.Unmarshal(payload, &event.Event); err != nil {
+			return nil, errors.Wrap(err, "failed to decode outbox event")
+		}
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to iterate outbox events")
+	}
+	return events, nil
+}
+
+func (r *outboxRepo) MarkSent(ctx context.Context, id uuid.UUID) error {
+	query := "UPDATE outbox_events SET sent_at = $1, last_error = NULL WHERE id = $2"
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, time.Now(), id)
+	return errors.Wrap(err, "failed to mark outbox event sent")
+}
+
+// RecordFailure records a failed dispatch of an event and when to try
+// again.
+func (r *outboxRepo) RecordFailure(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time, reason string) error {
+	query := "UPDATE outbox_events SET attempts = attempts + 1, next_attempt_at = $1, last_error = $2 WHERE id = $3"
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, nextAttemptAt, reason, id)
+	return errors.Wrap(err, "failed to record outbox failure")
+}
+
+// DeleteSent deletes the events of all tenants sent before the given time
+// and returns their number.
+func (r *outboxRepo) DeleteSent(ctx context.Context, before time.Time) (int, error) {
+	result, err := conn(ctx, r.db).ExecContext(ctx, "DELETE FROM outbox_events WHERE sent_at < $1", before)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to delete sent outbox events")
+	}
+
+	deleted, err := result.RowsAffected()
+	return int(deleted), errors.Wrap(err, "failed to delete sent outbox events")
+}
@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"subscription-service/internal/models"
+	"subscription-service/internal/tenant"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+type ServiceRepository interface {
+	Create(ctx context.Context, svc *models.Service) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Service, error)
+	Update(ctx context.Context, id uuid.UUID, req *models.UpdateServiceRequest) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	List(ctx context.Context, category string) ([]*models.Service, error)
+	Resolve(ctx context.Context, name string) (*models.Service, error)
+	ReplaceAliases(ctx context.Context, id uuid.UUID, aliases []string) error
+	LinkSubscriptions(ctx context.Context, svc *models.Service) ([]*models.SubscriptionChange, error)
+	UnlinkSubscriptions(ctx context.Context, id uuid.UUID) ([]*models.SubscriptionChange, error)
+}
+
+const serviceColumns = `
+        sv.id, sv.name, COALESCE((
+            SELECT array_agg(a.alias ORDER BY a.alias) FROM service_aliases a WHERE a.service_id = sv.id AND a.tenant_id = sv.tenant_id
+        ), '{}'), sv.category, sv.default_price, sv.currency, sv.created_at, sv.updated_at
+    `
+
+func scanService(row rowScanner) (*models.Service, error) {
+	var svc models.Service
+	err := row.Scan(
+		&svc.ID, &svc.Name, pq.Array(&svc.Aliases), &svc.Category, &svc.DefaultPrice, &svc.Currency, &svc.CreatedAt, &svc.UpdatedAt,
+	)
+	return &svc, err
+}
+
+type serviceRepo struct {
+	db *sql.DB
+}
+
+func NewServiceRepository(db *sql.DB) ServiceRepository {
+	return &serviceRepo{db: db}
+}
+
+func (r *serviceRepo) Create(ctx context.Context, svc *models.Service) error {
+	query := `
+        INSERT INTO services (id, tenant_id, name, category, default_price, currency, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    `
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		svc.ID, tenant.FromContext(ctx), svc.Name, svc.Category, svc.DefaultPrice, svc.Currency, svc.CreatedAt, svc.UpdatedAt)
+	if err != nil {
+		return errors.Wrap(err, "failed to create service")
+	}
+
+	return r.ReplaceAliases(ctx, svc.ID, svc.Aliases)
+}
+
+func (r *serviceRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Service, error) {
+	query := "SELECT " + serviceColumns + " FROM services sv WHERE sv.id = $1 AND sv.tenant_id = $2"
+
+	svc, err := scanService(conn(ctx, r.db).QueryRowContext(ctx, query, id, tenant.FromContext(ctx)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return svc, errors.Wrap(err, "failed to get service by id")
+}
+
+func (r *serviceRepo) Update(ctx context.Context, id uuid.UUID, req *models.UpdateServiceRequest) error {
+	query := "UPDATE services SET "
+	args := []interface{}{}
+	argPos := 1
+
+	if req.Name != nil {
+		query += fmt.Sprintf("name = $%d, ", argPos)
+		args = append(args, *req.Name)
+		argPos++
+	}
+
+	if req.Category != nil {
+		query += fmt.Sprintf("category = $%d, ", argPos)
+		args = append(args, *req.Category)
+		argPos++
+	}
+
+	if req.DefaultPrice != nil {
+		query += fmt.Sprintf("default_price = $%d, ", argPos)
+		args = append(args, *req.DefaultPrice)
+		argPos++
+	}
+
+	if req.Currency != nil {
+		query += fmt.Sprintf("currency = $%d, ", argPos)
+		args = append(args, *req.Currency)
+		argPos++
+	}
+
+	query += fmt.Sprintf("updated_at = $%d WHERE id = $%d AND tenant_id = $%d", argPos, argPos+1, argPos+2)
+	args = append(args, time.Now(), id, tenant.FromContext(ctx))
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, args...); err != nil {
+		return errors.Wrap(err, "failed to update service")
+	}
+
+	if req.Aliases == nil {
+		return nil
+	}
+	return r.ReplaceAliases(ctx, id, *req.Aliases)
+}
+
+func (r *serviceRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	query := "DELETE FROM services WHERE id = $1 AND tenant_id = $2"
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id, tenant.FromContext(ctx))
+	return errors.Wrap(err, "failed to delete service")
+}
+
+func (r *serviceRepo) List(ctx context.Context, category string) ([]*models.Service, error) {
+	b := newFilterBuilder().forTenant(ctx, "sv.tenant_id")
+	if category != "" {
+		b.add("lower(sv.category) = lower(%s)", category)
+	}
+
+	query := "SELECT " + serviceColumns + " FROM services sv" + b.where() + " ORDER BY sv.name"
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, b.args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list services")
+	}
+	defer rows.Close()
+
+	var services []*models.Service
+	for rows.Next() {
+		svc, err := scanService(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan service")
+		}
+		services = append(services, svc)
+	}
+
+	return services, errors.Wrap(rows.Err(), "failed to iterate services")
+}
+
+// Resolve finds the service whose name or one of whose aliases equals name,
+// ignoring case. It returns nil when there is none.
+func (r *serviceRepo) Resolve(ctx context.Context, name string) (*models.Service, error) {
+	query := "SELECT " + serviceColumns + `
+        FROM services sv
+        WHERE sv.tenant_id = $2 AND (
+            lower(sv.name) = lower($1)
+            OR sv.id IN (SELECT a.service_id FROM service_aliases a WHERE lower(a.alias) = lower($1) AND a.tenant_id = $2)
+        )
+        LIMIT 1
+    `
+
+	svc, err := scanService(conn(ctx, r.db).QueryRowContext(ctx, query, strings.TrimSpace(name), tenant.FromContext(ctx)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return svc, errors.Wrap(err, "failed to resolve service")
+}
+
+func (r *serviceRepo) ReplaceAliases(ctx context.Context, id uuid.UUID, aliases []string) error {
+	query := "DELETE FROM service_aliases WHERE service_id = $1 AND tenant_id = $2"
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, id, tenant.FromContext(ctx)); err != nil {
+		return errors.Wrap(err, "failed to delete service aliases")
+	}
+
+	for _, alias := range aliases {
+		query = "INSERT INTO service_aliases (service_id, tenant_id, alias) VALUES ($1, $2, $3)"
+		if _, err := conn(ctx, r.db).ExecContext(ctx, query, id, tenant.FromContext(ctx), alias); err != nil {
+			return errors.Wrap(err, "failed to add service alias")
+		}
+	}
+
+	return nil
+}
+
+// LinkSubscriptions attaches the subscriptions named after the service or one
+// of its aliases that are not linked to any service yet, and renames all
+// subscriptions of the service to its canonical name. Subscriptions already
+// linked under that name are left alone and keep their version. It returns
+// the changed subscriptions as they were before and after.
+func (r *serviceRepo) LinkSubscriptions(ctx context.Context, svc *models.Service) ([]*models.SubscriptionChange, error) {
+	names := make([]string, 0, len(svc.Aliases)+1)
+	for _, name := range append([]string{svc.Name}, svc.Aliases...) {
+		names = append(names, strings.ToLower(name))
+	}
+
+	query := `
+        WITH old AS (
+            SELECT * FROM subscriptions
+            WHERE tenant_id = $5 AND (service_id = $1 OR (service_id IS NULL AND lower(service_name) = ANY($4)))
+                AND (service_name <> $2 OR service_id IS DISTINCT FROM $1)
+            FOR UPDATE
+        )
+        UPDATE subscriptions s SET service_id = $1, service_name = $2, updated_at = $3, version = s.version + 1
+        FROM old WHERE s.id = old.id
+        RETURNING ` + oldSubscriptionColumns + ", " + subscriptionColumns
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, svc.ID, svc.Name, time.Now(), pq.Array(names), tenant.FromContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to link subscriptions to service")
+	}
+	return scanSubscriptionChanges(rows)
+}
+
+// UnlinkSubscriptions detaches the subscriptions of a service, which keep
+// their name. It returns the changed subscriptions as they were before and
+// after.
+func (r *serviceRepo) UnlinkSubscriptions(ctx context.Context, id uuid.UUID) ([]*models.SubscriptionChange, error) {
+	query := `
+        WITH old AS (
+            SELECT * FROM subscriptions WHERE service_id = $1 AND tenant_id = $3
+            FOR UPDATE
+        )
+        UPDATE subscriptions s SET service_id = NULL, updated_at = $2, version = s.version + 1
+        FROM old WHERE s.id = old.id
+        RETURNING ` + oldSubscriptionColumns + ", " + subscriptionColumns
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, id, time.Now(), tenant.FromContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unlink subscriptions from service")
+	}
+	return scanSubscriptionChanges(rows)
+}
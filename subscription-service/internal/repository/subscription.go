@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"subscription-service/internal/models"
+	"subscription-service/internal/tenant"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,13 +15,102 @@ import (
 
 type SubscriptionRepository interface {
 	Create(ctx context.Context, sub *models.Subscription) error
-	GetByID(ctx context.Context, id uuid.UUID) (*models.Subscription, error)
-	Update(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionRequest) error
-	Delete(ctx context.Context, id uuid.UUID) error
-	List(ctx context.Context, filter *models.SubscriptionFilter) ([]*models.Subscription, error)
-	GetTotalCost(ctx context.Context, filter *models.SubscriptionFilter) (int, error)
+	GetByID(ctx context.Context, id uuid.UUID, includeDeleted bool) (*models.Subscription, error)
+	Update(ctx context.Context, id uuid.UUID, version int, req *models.UpdateSubscriptionRequest) (bool, error)
+	Delete(ctx context.Context, id uuid.UUID, version int) (bool, error)
+	Restore(ctx context.Context, id uuid.UUID) error
+	PurgeDeleted(ctx context.Context, before time.Time) (map[string][]uuid.UUID, error)
+	List(ctx context.Context, filter *models.SubscriptionFilter, opts *models.ListOptions) ([]*models.Subscription, error)
+	Each(ctx context.Context, filter *models.SubscriptionFilter, opts *models.ListOptions, fn func(*models.Subscription) error) error
+	Count(ctx context.Context, filter *models.SubscriptionFilter) (int, error)
+	GetTotalCost(ctx context.Context, filter *models.SubscriptionFilter, currency string) (int, error)
+	GetCostBreakdown(ctx context.Context, filter *models.SubscriptionFilter, currency string) ([]*models.CostBreakdownLine, error)
+	GetCostByService(ctx context.Context, filter *models.SubscriptionFilter, currency string) ([]*models.ServiceCost, error)
+	LinkService(ctx context.Context, id uuid.UUID, serviceID *uuid.UUID) error
+	DeleteByUser(ctx context.Context, userID uuid.UUID) ([]*models.SubscriptionChange, error)
+	ReassignUser(ctx context.Context, from, to uuid.UUID) ([]*models.SubscriptionChange, error)
+	UpdateStatus(ctx context.Context, id uuid.UUID, from, to models.SubscriptionStatus, endDate *time.Time) (bool, error)
+	StartPause(ctx context.Context, id uuid.UUID, month time.Time) error
+	EndPause(ctx context.Context, id uuid.UUID, lastMonth time.Time) error
+	AddPriceChange(ctx context.Context, id uuid.UUID, price int, currency string, effectiveFrom time.Time) error
+	ListPriceHistory(ctx context.Context, id uuid.UUID) ([]*models.PriceChange, error)
 }
 
+// currentMonth is the current month as an SQL date.
+const currentMonth = "date_trunc('month', LOCALTIMESTAMP)::date"
+
+// priceInEffect returns an expression for the price or currency, as named
+// by column, of subscription s in effect in month: that of the latest price
+// change effective by then or, before the first change, that of the first
+// one. Subscriptions without recorded prices fall back to their own column.
+func priceInEffect(column, month string) string {
+	return fmt.Sprintf(`COALESCE((
+            SELECT sp.%[1]s FROM subscription_prices sp WHERE sp.subscription_id = s.id
+            ORDER BY sp.effective_from > %[2]s, abs(sp.effective_from - %[2]s)
+            LIMIT 1
+        ), s.%[1]s)`, column, month)
+}
+
+// subscriptionColumns report the price in effect in the current month, so
+// that prices changing later are not shown, sorted or filtered by early.
+var subscriptionColumns = `
+        s.id, s.service_name, s.service_id, ` + priceInEffect("price", currentMonth) + `,
+        ` + priceInEffect("currency", currentMonth) + `, s.user_id, s.start_date, s.end_date, s.status,
+        s.billing_period, s.billing_interval, s.billing_anchor_day, s.created_at, s.updated_at, s.deleted_at, s.version
+    `
+
+// oldSubscriptionColumns are the subscription columns of the old rows of
+// statements changing many subscriptions at once, selected as old.
+var oldSubscriptionColumns = strings.ReplaceAll(subscriptionColumns, " s.", " old.")
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func subscriptionFields(sub *models.Subscription) []interface{} {
+	return []interface{}{
+		&sub.ID, &sub.ServiceName, &sub.ServiceID, &sub.Price, &sub.Currency, &sub.UserID, &sub.StartDate, &sub.EndDate, &sub.Status,
+		&sub.BillingPeriod, &sub.BillingInterval, &sub.BillingAnchorDay, &sub.CreatedAt, &sub.UpdatedAt, &sub.DeletedAt, &sub.Version,
+	}
+}
+
+func scanSubscription(row rowScanner) (*models.Subscription, error) {
+	var sub models.Subscription
+	err := row.Scan(subscriptionFields(&sub)...)
+	return &sub, err
+}
+
+// scanSubscriptionChanges reads the rows of statements returning the old
+// columns of the changed subscriptions followed by their new ones.
+func scanSubscriptionChanges(rows *sql.Rows) ([]*models.SubscriptionChange, error) {
+	defer rows.Close()
+
+	var changes []*models.SubscriptionChange
+	for rows.Next() {
+		change := &models.SubscriptionChange{Before: &models.Subscription{}, After: &models.Subscription{}}
+		if err := rows.Scan(append(subscriptionFields(change.Before), subscriptionFields(change.After)...)...); err != nil {
+			return nil, errors.Wrap(err, "failed to scan changed subscription")
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, errors.Wrap(rows.Err(), "failed to iterate changed subscriptions")
+}
+
+// sortColumns maps the supported sort fields to their column and the type
+// the cursor value has to be cast to when comparing keyset positions.
+var sortColumns = map[string]struct {
+	column string
+	cast   string
+}{
+	models.SortByCreatedAt:   {column: "s.created_at", cast: "timestamp"},
+	models.SortByPrice:       {column: priceInEffect("price", currentMonth), cast: "integer"},
+	models.SortByStartDate:   {column: "s.start_date", cast: "date"},
+	models.SortByServiceName: {column: "s.service_name", cast: "text"},
+}
+
+// subscriptionRepo keeps the subscriptions of each tenant apart: every query
+// is restricted to the tenant of its context.
 type subscriptionRepo struct {
 	db *sql.DB
 }
@@ -30,35 +121,38 @@ func NewSubscriptionRepository(db *sql.DB) SubscriptionRepository {
 
 func (r *subscriptionRepo) Create(ctx context.Context, sub *models.Subscription) error {
 	query := `
-        INSERT INTO subscriptions (id, service_name, price, user_id, start_date, end_date, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        INSERT INTO subscriptions (id, tenant_id, service_name, service_id, price, currency, user_id, start_date, end_date, status,
+            billing_period, billing_interval, billing_anchor_day, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
     `
 
-	_, err := r.db.ExecContext(ctx, query,
-		sub.ID, sub.ServiceName, sub.Price, sub.UserID, sub.StartDate, sub.EndDate, sub.CreatedAt, sub.UpdatedAt)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		sub.ID, tenant.FromContext(ctx), sub.ServiceName, sub.ServiceID, sub.Price, sub.Currency, sub.UserID, sub.StartDate, sub.EndDate, sub.Status,
+		sub.BillingPeriod, sub.BillingInterval, sub.BillingAnchorDay, sub.CreatedAt, sub.UpdatedAt)
 
 	return errors.Wrap(err, "failed to create subscription")
 }
 
-func (r *subscriptionRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
-	query := `
-        SELECT id, service_name, price, user_id, start_date, end_date, created_at, updated_at
-        FROM subscriptions WHERE id = $1
-    `
-
-	var sub models.Subscription
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&sub.ID, &sub.ServiceName, &sub.Price, &sub.UserID, &sub.StartDate, &sub.EndDate, &sub.CreatedAt, &sub.UpdatedAt,
-	)
+// GetByID returns nil for deleted subscriptions unless includeDeleted is
+// set.
+func (r *subscriptionRepo) GetByID(ctx context.Context, id uuid.UUID, includeDeleted bool) (*models.Subscription, error) {
+	query := "SELECT " + subscriptionColumns + " FROM subscriptions s WHERE s.id = $1 AND s.tenant_id = $2"
+	if !includeDeleted {
+		query += " AND s.deleted_at IS NULL"
+	}
 
+	sub, err := scanSubscription(conn(ctx, r.db).QueryRowContext(ctx, query, id, tenant.FromContext(ctx)))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 
-	return &sub, errors.Wrap(err, "failed to get subscription by id")
+	return sub, errors.Wrap(err, "failed to get subscription by id")
 }
 
-func (r *subscriptionRepo) Update(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionRequest) error {
+// Update applies req to a subscription that is still at version and
+// increments the version. It reports whether it did, i.e. whether the
+// subscription had not been changed since version was read.
+func (r *subscriptionRepo) Update(ctx context.Context, id uuid.UUID, version int, req *models.UpdateSubscriptionRequest) (bool, error) {
 	query := "UPDATE subscriptions SET "
 	args := []interface{}{}
 	argPos := 1
@@ -75,10 +169,16 @@ func (r *subscriptionRepo) Update(ctx context.Context, id uuid.UUID, req *models
 		argPos++
 	}
 
+	if req.Currency != nil {
+		query += fmt.Sprintf("currency = $%d, ", argPos)
+		args = append(args, *req.Currency)
+		argPos++
+	}
+
 	if req.StartDate != nil {
 		startDate, err := time.Parse("01-2006", *req.StartDate)
 		if err != nil {
-			return errors.Wrap(err, "invalid start date format")
+			return false, errors.Wrap(err, "invalid start date format")
 		}
 		query += fmt.Sprintf("start_date = $%d, ", argPos)
 		args = append(args, startDate)
@@ -91,7 +191,7 @@ func (r *subscriptionRepo) Update(ctx context.Context, id uuid.UUID, req *models
 		} else {
 			endDate, err := time.Parse("01-2006", *req.EndDate)
 			if err != nil {
-				return errors.Wrap(err, "invalid end date format")
+				return false, errors.Wrap(err, "invalid end date format")
 			}
 			query += fmt.Sprintf("end_date = $%d, ", argPos)
 			args = append(args, endDate)
@@ -99,101 +199,367 @@ func (r *subscriptionRepo) Update(ctx context.Context, id uuid.UUID, req *models
 		}
 	}
 
-	query += fmt.Sprintf("updated_at = $%d WHERE id = $%d", argPos, argPos+1)
-	args = append(args, time.Now(), id)
+	if req.BillingPeriod != nil {
+		query += fmt.Sprintf("billing_period = $%d, ", argPos)
+		args = append(args, *req.BillingPeriod)
+		argPos++
+	}
+
+	if req.BillingInterval != nil {
+		query += fmt.Sprintf("billing_interval = $%d, ", argPos)
+		args = append(args, *req.BillingInterval)
+		argPos++
+	}
+
+	if req.BillingAnchorDay != nil {
+		query += fmt.Sprintf("billing_anchor_day = $%d, ", argPos)
+		args = append(args, *req.BillingAnchorDay)
+		argPos++
+	}
+
+	query += fmt.Sprintf("version = version + 1, updated_at = $%d WHERE id = $%d AND tenant_id = $%d AND version = $%d",
+		argPos, argPos+1, argPos+2, argPos+3)
+	args = append(args, time.Now(), id, tenant.FromContext(ctx), version)
 
-	_, err := r.db.ExecContext(ctx, query, args...)
-	return errors.Wrap(err, "failed to update subscription")
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to update subscription")
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, errors.Wrap(err, "failed to update subscription")
 }
 
-func (r *subscriptionRepo) Delete(ctx context.Context, id uuid.UUID) error {
-	query := "DELETE FROM subscriptions WHERE id = $1"
-	_, err := r.db.ExecContext(ctx, query, id)
-	return errors.Wrap(err, "failed to delete subscription")
+// Delete marks a subscription that is still at version deleted and reports
+// whether it did. It keeps its price history and stays restorable until
+// PurgeDeleted removes it.
+func (r *subscriptionRepo) Delete(ctx context.Context, id uuid.UUID, version int) (bool, error) {
+	query := `
+        UPDATE subscriptions SET deleted_at = $1, updated_at = $1, version = version + 1
+        WHERE id = $2 AND tenant_id = $3 AND version = $4 AND deleted_at IS NULL
+    `
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, time.Now(), id, tenant.FromContext(ctx), version)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to delete subscription")
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, errors.Wrap(err, "failed to delete subscription")
 }
 
-func (r *subscriptionRepo) List(ctx context.Context, filter *models.SubscriptionFilter) ([]*models.Subscription, error) {
+func (r *subscriptionRepo) Restore(ctx context.Context, id uuid.UUID) error {
 	query := `
-        SELECT id, service_name, price, user_id, start_date, end_date, created_at, updated_at
-        FROM subscriptions WHERE 1=1
+        UPDATE subscriptions SET deleted_at = NULL, updated_at = $1, version = version + 1
+        WHERE id = $2 AND tenant_id = $3
     `
-	args := []interface{}{}
-	argPos := 1
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, time.Now(), id, tenant.FromContext(ctx))
+	return errors.Wrap(err, "failed to restore subscription")
+}
 
-	if filter.UserID != nil {
-		query += fmt.Sprintf(" AND user_id = $%d", argPos)
-		args = append(args, *filter.UserID)
-		argPos++
+// PurgeDeleted permanently removes the subscriptions deleted before the given
+// time together with their history, across all tenants, so it needs a
+// connection that bypasses row-level security. It returns the ids of the
+// removed subscriptions by tenant.
+func (r *subscriptionRepo) PurgeDeleted(ctx context.Context, before time.Time) (map[string][]uuid.UUID, error) {
+	query := "DELETE FROM subscriptions WHERE deleted_at < $1 RETURNING tenant_id, id"
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, before)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to purge deleted subscriptions")
 	}
+	defer rows.Close()
 
-	if filter.ServiceName != nil {
-		query += fmt.Sprintf(" AND service_name ILIKE $%d", argPos)
-		args = append(args, "%"+*filter.ServiceName+"%")
-		argPos++
+	purged := map[string][]uuid.UUID{}
+	for rows.Next() {
+		var tenantID string
+		var id uuid.UUID
+		if err := rows.Scan(&tenantID, &id); err != nil {
+			return nil, errors.Wrap(err, "failed to scan purged subscription")
+		}
+		purged[tenantID] = append(purged[tenantID], id)
 	}
 
-	query += " ORDER BY created_at DESC"
+	return purged, errors.Wrap(rows.Err(), "failed to iterate purged subscriptions")
+}
 
-	rows, err := r.db.QueryContext(ctx, query, args...)
+// DeleteByUser deletes the subscriptions of a user that are not deleted yet
+// like Delete does and returns them as they were before and after.
+func (r *subscriptionRepo) DeleteByUser(ctx context.Context, userID uuid.UUID) ([]*models.SubscriptionChange, error) {
+	query := `
+        WITH old AS (
+            SELECT * FROM subscriptions WHERE user_id = $2 AND tenant_id = $3 AND deleted_at IS NULL FOR UPDATE
+        )
+        UPDATE subscriptions s SET deleted_at = $1, updated_at = $1, version = s.version + 1
+        FROM old WHERE s.id = old.id
+        RETURNING ` + oldSubscriptionColumns + ", " + subscriptionColumns
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, time.Now(), userID, tenant.FromContext(ctx))
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to list subscriptions")
+		return nil, errors.Wrap(err, "failed to delete subscriptions of user")
 	}
-	defer rows.Close()
+	return scanSubscriptionChanges(rows)
+}
+
+// ReassignUser moves the subscriptions of a user, including deleted ones, to
+// another user and returns them as they were before and after.
+func (r *subscriptionRepo) ReassignUser(ctx context.Context, from, to uuid.UUID) ([]*models.SubscriptionChange, error) {
+	query := `
+        WITH old AS (
+            SELECT * FROM subscriptions WHERE user_id = $3 AND tenant_id = $4 FOR UPDATE
+        )
+        UPDATE subscriptions s SET user_id = $1, updated_at = $2, version = s.version + 1
+        FROM old WHERE s.id = old.id
+        RETURNING ` + oldSubscriptionColumns + ", " + subscriptionColumns
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, to, time.Now(), from, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to reassign subscriptions of user")
+	}
+	return scanSubscriptionChanges(rows)
+}
 
+func (r *subscriptionRepo) List(ctx context.Context, filter *models.SubscriptionFilter, opts *models.ListOptions) ([]*models.Subscription, error) {
 	var subscriptions []*models.Subscription
+	err := r.Each(ctx, filter, opts, func(sub *models.Subscription) error {
+		subscriptions = append(subscriptions, sub)
+		return nil
+	})
+	return subscriptions, err
+}
+
+// Each passes the subscriptions List would return to fn as they are read
+// from the database, so that they need not be held in memory together. It
+// stops at the first error of fn.
+func (r *subscriptionRepo) Each(ctx context.Context, filter *models.SubscriptionFilter, opts *models.ListOptions, fn func(*models.Subscription) error) error {
+	sort, ok := sortColumns[opts.Sort]
+	if !ok {
+		return errors.Errorf("unsupported sort field %q", opts.Sort)
+	}
+
+	direction, comparison := "ASC", ">"
+	if opts.Order == models.SortDesc {
+		direction, comparison = "DESC", "<"
+	}
+
+	b := newFilterBuilder().forTenant(ctx, "s.tenant_id").apply(filter)
+	query := "SELECT " + subscriptionColumns + " FROM subscriptions s" + b.where()
+	args := b.args
+
+	// The id breaks ties between equal sort values, so (column, id) is a
+	// strict total order that can be resumed from the cursor position.
+	if opts.After != nil {
+		query += fmt.Sprintf(" AND (%s, s.id) %s ($%d::%s, $%d)",
+			sort.column, comparison, len(args)+1, sort.cast, len(args)+2)
+		args = append(args, opts.After.Value, opts.After.ID)
+	}
+
+	query += fmt.Sprintf(" ORDER BY %s %s, s.id %s", sort.column, direction, direction)
+	if opts.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT $%d", len(args)+1)
+		args = append(args, opts.Limit)
+	}
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "failed to list subscriptions")
+	}
+	defer rows.Close()
+
 	for rows.Next() {
-		var sub models.Subscription
-		err := rows.Scan(
-			&sub.ID, &sub.ServiceName, &sub.Price, &sub.UserID, &sub.StartDate, &sub.EndDate, &sub.CreatedAt, &sub.UpdatedAt,
-		)
+		sub, err := scanSubscription(rows)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to scan subscription")
+			return errors.Wrap(err, "failed to scan subscription")
+		}
+		if err := fn(sub); err != nil {
+			return err
 		}
-		subscriptions = append(subscriptions, &sub)
 	}
 
-	return subscriptions, nil
+	return errors.Wrap(rows.Err(), "failed to iterate subscriptions")
 }
 
-func (r *subscriptionRepo) GetTotalCost(ctx context.Context, filter *models.SubscriptionFilter) (int, error) {
-	query := "SELECT COALESCE(SUM(price), 0) FROM subscriptions WHERE 1=1"
-	args := []interface{}{}
-	argPos := 1
+func (r *subscriptionRepo) Count(ctx context.Context, filter *models.SubscriptionFilter) (int, error) {
+	b := newFilterBuilder().forTenant(ctx, "s.tenant_id").apply(filter)
+	query := "SELECT COUNT(*) FROM subscriptions s" + b.where()
 
-	if filter.UserID != nil {
-		query += fmt.Sprintf(" AND user_id = $%d", argPos)
-		args = append(args, *filter.UserID)
-		argPos++
+	var total int
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, b.args...).Scan(&total)
+	return total, errors.Wrap(err, "failed to count subscriptions")
+}
+
+// GetTotalCost returns the cost of the subscriptions matching filter in
+// currency. It fails with ErrMissingExchangeRate when a price cannot be
+// converted.
+func (r *subscriptionRepo) GetTotalCost(ctx context.Context, filter *models.SubscriptionFilter, currency string) (int, error) {
+	charges, args := chargesQuery(ctx, filter, currency)
+	query := `
+        SELECT COALESCE(SUM(c.amount), 0)::bigint,
+            COALESCE(string_agg(DISTINCT c.currency || ' in ' || to_char(c.month, 'MM-YYYY'), ', ') FILTER (WHERE c.amount IS NULL), '')
+        FROM (` + charges + `) c
+    `
+
+	var totalCost int
+	var missing string
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, args...).Scan(&totalCost, &missing); err != nil {
+		return 0, errors.Wrap(err, "failed to calculate total cost")
 	}
 
-	if filter.ServiceName != nil {
-		query += fmt.Sprintf(" AND service_name ILIKE $%d", argPos)
-		args = append(args, "%"+*filter.ServiceName+"%")
-		argPos++
+	if missing != "" {
+		return 0, errors.Wrapf(ErrMissingExchangeRate, "no rate to %s for %s", currency, missing)
 	}
 
-	if filter.StartDate != nil {
-		startDate, err := time.Parse("01-2006", *filter.StartDate)
-		if err != nil {
-			return 0, errors.Wrap(err, "invalid start date format")
+	return totalCost, nil
+}
+
+func (r *subscriptionRepo) GetCostBreakdown(ctx context.Context, filter *models.SubscriptionFilter, currency string) ([]*models.CostBreakdownLine, error) {
+	if filter.StartDate == nil || filter.EndDate == nil {
+		return nil, errors.New("start date and end date are required")
+	}
+
+	charges, args := chargesQuery(ctx, filter, currency)
+	query := `
+        SELECT to_char(c.month, 'MM-YYYY'), c.service_id, c.service_name, c.user_id, COALESCE(SUM(c.amount), 0)::bigint,
+            COALESCE(string_agg(DISTINCT c.currency, ', ') FILTER (WHERE c.amount IS NULL), '')
+        FROM (` + charges + `) c
+        GROUP BY c.month, c.service_id, c.service_name, c.user_id
+        ORDER BY c.month, c.service_name, c.user_id
+    `
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to calculate cost breakdown")
+	}
+	defer rows.Close()
+
+	var lines []*models.CostBreakdownLine
+	for rows.Next() {
+		var line models.CostBreakdownLine
+		var missing string
+		if err := rows.Scan(&line.Month, &line.ServiceID, &line.ServiceName, &line.UserID, &line.Amount, &missing); err != nil {
+			return nil, errors.Wrap(err, "failed to scan cost breakdown line")
 		}
-		query += fmt.Sprintf(" AND start_date >= $%d", argPos)
-		args = append(args, startDate)
-		argPos++
+		if missing != "" {
+			return nil, errors.Wrapf(ErrMissingExchangeRate, "no rate from %s to %s for %s", missing, currency, line.Month)
+		}
+		lines = append(lines, &line)
 	}
 
-	if filter.EndDate != nil {
-		endDate, err := time.Parse("01-2006", *filter.EndDate)
-		if err != nil {
-			return 0, errors.Wrap(err, "invalid end date format")
+	return lines, errors.Wrap(rows.Err(), "failed to iterate cost breakdown")
+}
+
+// GetCostByService sums the cost of the subscriptions matching filter per
+// catalog service. Subscriptions not linked to the catalog are grouped by
+// their service name.
+func (r *subscriptionRepo) GetCostByService(ctx context.Context, filter *models.SubscriptionFilter, currency string) ([]*models.ServiceCost, error) {
+	charges, args := chargesQuery(ctx, filter, currency)
+	query := `
+        SELECT c.service_id, c.service_name, c.category, COALESCE(SUM(c.amount), 0)::bigint,
+            COALESCE(string_agg(DISTINCT c.currency || ' in ' || to_char(c.month, 'MM-YYYY'), ', ') FILTER (WHERE c.amount IS NULL), '')
+        FROM (` + charges + `) c
+        GROUP BY c.service_id, c.service_name, c.category
+        ORDER BY 4 DESC, c.service_name
+    `
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to calculate cost by service")
+	}
+	defer rows.Close()
+
+	var costs []*models.ServiceCost
+	for rows.Next() {
+		var cost models.ServiceCost
+		var missing string
+		if err := rows.Scan(&cost.ServiceID, &cost.ServiceName, &cost.Category, &cost.Amount, &missing); err != nil {
+			return nil, errors.Wrap(err, "failed to scan service cost")
 		}
-		nextMonth := endDate.AddDate(0, 1, 0)
-		query += fmt.Sprintf(" AND (start_date < $%d OR end_date IS NULL OR end_date < $%d)", argPos, argPos)
-		args = append(args, nextMonth)
-		argPos++
+		if missing != "" {
+			return nil, errors.Wrapf(ErrMissingExchangeRate, "no rate to %s for %s", currency, missing)
+		}
+		costs = append(costs, &cost)
 	}
 
-	var totalCost int
-	err := r.db.QueryRowContext(ctx, query, args...).Scan(&totalCost)
-	return totalCost, errors.Wrap(err, "failed to calculate total cost")
+	return costs, errors.Wrap(rows.Err(), "failed to iterate service costs")
+}
+
+// LinkService links a subscription to a catalog service, or unlinks it when
+// serviceID is nil. It is only called along with Update, which increments
+// the version.
+func (r *subscriptionRepo) LinkService(ctx context.Context, id uuid.UUID, serviceID *uuid.UUID) error {
+	query := "UPDATE subscriptions SET service_id = $1 WHERE id = $2 AND tenant_id = $3"
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, serviceID, id, tenant.FromContext(ctx))
+	return errors.Wrap(err, "failed to link subscription to service")
+}
+
+// UpdateStatus moves a subscription from one status to another. It reports
+// false when the subscription is no longer in the from status, which happens
+// when a concurrent request changed it first. A non-nil endDate replaces the
+// end date of the subscription.
+func (r *subscriptionRepo) UpdateStatus(ctx context.Context, id uuid.UUID, from, to models.SubscriptionStatus, endDate *time.Time) (bool, error) {
+	query := `
+        UPDATE subscriptions
+        SET status = $1, end_date = COALESCE($2, end_date), updated_at = $3, version = version + 1
+        WHERE id = $4 AND status = $5 AND tenant_id = $6
+    `
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, to, endDate, time.Now(), id, from, tenant.FromContext(ctx))
+	if err != nil {
+		return false, errors.Wrap(err, "failed to update subscription status")
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, errors.Wrap(err, "failed to update subscription status")
+}
+
+func (r *subscriptionRepo) StartPause(ctx context.Context, id uuid.UUID, month time.Time) error {
+	query := "INSERT INTO subscription_pauses (subscription_id, tenant_id, start_month) VALUES ($1, $2, $3)"
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id, tenant.FromContext(ctx), month)
+	return errors.Wrap(err, "failed to start subscription pause")
+}
+
+func (r *subscriptionRepo) EndPause(ctx context.Context, id uuid.UUID, lastMonth time.Time) error {
+	query := `
+        UPDATE subscription_pauses SET end_month = $1
+        WHERE subscription_id = $2 AND tenant_id = $3 AND end_month IS NULL
+    `
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, lastMonth, id, tenant.FromContext(ctx))
+	return errors.Wrap(err, "failed to end subscription pause")
+}
+
+// AddPriceChange records the price in currency that applies from
+// effectiveFrom on. A change recorded for the same month before is replaced.
+func (r *subscriptionRepo) AddPriceChange(ctx context.Context, id uuid.UUID, price int, currency string, effectiveFrom time.Time) error {
+	query := `
+        INSERT INTO subscription_prices (subscription_id, tenant_id, price, currency, effective_from)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (subscription_id, effective_from) DO UPDATE
+            SET price = EXCLUDED.price, currency = EXCLUDED.currency, created_at = NOW()
+    `
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id, tenant.FromContext(ctx), price, currency, effectiveFrom)
+	return errors.Wrap(err, "failed to add price change")
+}
+
+func (r *subscriptionRepo) ListPriceHistory(ctx context.Context, id uuid.UUID) ([]*models.PriceChange, error) {
+	query := `
+        SELECT id, subscription_id, price, currency, effective_from, created_at
+        FROM subscription_prices WHERE subscription_id = $1 AND tenant_id = $2
+        ORDER BY effective_from
+    `
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, id, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list price history")
+	}
+	defer rows.Close()
+
+	var history []*models.PriceChange
+	for rows.Next() {
+		var change models.PriceChange
+		if err := rows.Scan(&change.ID, &change.SubscriptionID, &change.Price, &change.Currency, &change.EffectiveFrom, &change.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "failed to scan price change")
+		}
+		history = append(history, &change)
+	}
+
+	return history, errors.Wrap(rows.Err(), "failed to iterate price history")
 }
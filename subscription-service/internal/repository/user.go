@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"subscription-service/internal/models"
+	"subscription-service/internal/tenant"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+type UserRepository interface {
+	Create(ctx context.Context, user *models.User) (bool, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	Update(ctx context.Context, id uuid.UUID, req *models.UpdateUserRequest) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	PurgeDeleted(ctx context.Context) (int, error)
+	List(ctx context.Context) ([]*models.User, error)
+	SetCalendarToken(ctx context.Context, id uuid.UUID, hash *string) (bool, error)
+	GetByCalendarToken(ctx context.Context, hash string) (*models.User, string, error)
+}
+
+const userColumns = "u.id, u.name, u.email, u.created_at, u.updated_at"
+
+func scanUser(row rowScanner) (*models.User, error) {
+	var user models.User
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+	return &user, err
+}
+
+type userRepo struct {
+	db *sql.DB
+}
+
+func NewUserRepository(db *sql.DB) UserRepository {
+	return &userRepo{db: db}
+}
+
+// Create reports false without creating anything when the id is taken,
+// possibly by a user of another tenant.
+func (r *userRepo) Create(ctx context.Context, user *models.User) (bool, error) {
+	query := `
+        INSERT INTO users (id, tenant_id, name, email, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (id) DO NOTHING
+    `
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, user.ID, tenant.FromContext(ctx), user.Name, user.Email, user.CreatedAt, user.UpdatedAt)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to create user")
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, errors.Wrap(err, "failed to create user")
+}
+
+func (r *userRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	query := "SELECT " + userColumns + " FROM users u WHERE u.id = $1 AND u.tenant_id = $2 AND u.deleted_at IS NULL"
+
+	user, err := scanUser(conn(ctx, r.db).QueryRowContext(ctx, query, id, tenant.FromContext(ctx)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return user, errors.Wrap(err, "failed to get user by id")
+}
+
+func (r *userRepo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	query := "SELECT " + userColumns + " FROM users u WHERE lower(u.email) = lower($1) AND u.tenant_id = $2 AND u.deleted_at IS NULL"
+
+	user, err := scanUser(conn(ctx, r.db).QueryRowContext(ctx, query, email, tenant.FromContext(ctx)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return user, errors.Wrap(err, "failed to get user by email")
+}
+
+func (r *userRepo) Update(ctx context.Context, id uuid.UUID, req *models.UpdateUserRequest) error {
+	query := "UPDATE users SET "
+	args := []interface{}{}
+	argPos := 1
+
+	if req.Name != nil {
+		query += fmt.Sprintf("name = $%d, ", argPos)
+		args = append(args, *req.Name)
+		argPos++
+	}
+
+	if req.Email != nil {
+		if *req.Email == "" {
+			query += "email = NULL, "
+		} else {
+			query += fmt.Sprintf("email = $%d, ", argPos)
+			args = append(args, *req.Email)
+			argPos++
+		}
+	}
+
+	query += fmt.Sprintf("updated_at = $%d WHERE id = $%d AND tenant_id = $%d AND deleted_at IS NULL", argPos, argPos+1, argPos+2)
+	args = append(args, time.Now(), id, tenant.FromContext(ctx))
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, args...)
+	return errors.Wrap(err, "failed to update user")
+}
+
+// Delete marks a user as deleted and removes its calendar token. The user is
+// removed by PurgeDeleted once its subscriptions are gone.
+func (r *userRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `
+        WITH removed AS (DELETE FROM calendar_tokens WHERE user_id = $2 AND tenant_id = $3)
+        UPDATE users SET deleted_at = $1, updated_at = $1 WHERE id = $2 AND tenant_id = $3 AND deleted_at IS NULL
+    `
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, time.Now(), id, tenant.FromContext(ctx))
+	return errors.Wrap(err, "failed to delete user")
+}
+
+// PurgeDeleted permanently removes the deleted users of all tenants that no
+// subscription references anymore and returns how many it removed.
+func (r *userRepo) PurgeDeleted(ctx context.Context) (int, error) {
+	query := `
+        DELETE FROM users u
+        WHERE u.deleted_at IS NOT NULL AND NOT EXISTS (SELECT 1 FROM subscriptions s WHERE s.user_id = u.id)
+    `
+	result, err := conn(ctx, r.db).ExecContext(ctx, query)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge deleted users")
+	}
+
+	purged, err := result.RowsAffected()
+	return int(purged), errors.Wrap(err, "failed to purge deleted users")
+}
+
+func (r *userRepo) List(ctx context.Context) ([]*models.User, error) {
+	query := "SELECT " + userColumns + " FROM users u WHERE u.tenant_id = $1 AND u.deleted_at IS NULL ORDER BY u.name, u.id"
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list users")
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan user")
+		}
+		users = append(users, user)
+	}
+
+	return users, errors.Wrap(rows.Err(), "failed to iterate users")
+}
+
+// SetCalendarToken replaces the calendar token of a user by the one with
+// the given hash, or removes it when hash is nil. It reports whether the
+// user exists.
+func (r *userRepo) SetCalendarToken(ctx context.Context, id uuid.UUID, hash *string) (bool, error) {
+	query := `
+        WITH u AS (SELECT id, tenant_id FROM users WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL),
+        removed AS (DELETE FROM calendar_tokens WHERE $3::CHAR(64) IS NULL AND user_id IN (SELECT id FROM u)),
+        added AS (
+            INSERT INTO calendar_tokens (token_hash, tenant_id, user_id)
+            SELECT $3, tenant_id, id FROM u WHERE $3::CHAR(64) IS NOT NULL
+            ON CONFLICT (user_id) DO UPDATE SET token_hash = EXCLUDED.token_hash
+        )
+        SELECT EXISTS (SELECT 1 FROM u)`
+
+	var exists bool
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, id, tenant.FromContext(ctx), hash).Scan(&exists)
+	return exists, errors.Wrap(err, "failed to set calendar token")
+}
+
+// GetByCalendarToken returns the user owning the calendar token with the
+// given hash together with its tenant. Tokens identify their tenant, so the
+// lookup is not restricted to the tenant of ctx.
+func (r *userRepo) GetByCalendarToken(ctx context.Context, hash string) (*models.User, string, error) {
+	query := "SELECT user_id, tenant_id FROM calendar_tokens WHERE token_hash = $1"
+
+	var userID uuid.UUID
+	var tenantID string
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, hash).Scan(&userID, &tenantID)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to get calendar token")
+	}
+
+	user, err := r.GetByID(tenant.WithID(ctx, tenantID), userID)
+	if err != nil || user == nil {
+		return nil, "", err
+	}
+	return user, tenantID, nil
+}
@@ -0,0 +1,295 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"subscription-service/internal/models"
+	"subscription-service/internal/tenant"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// WebhookRepository stores webhook endpoints and the deliveries of events to
+// them. Claiming and completing deliveries is done for all tenants at once,
+// which takes a connection that bypasses row-level security; everything else
+// is restricted to the tenant of the context.
+type WebhookRepository interface {
+	CreateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error
+	GetEndpoint(ctx context.Context, id uuid.UUID) (*models.WebhookEndpoint, error)
+	ListEndpoints(ctx context.Context) ([]*models.WebhookEndpoint, error)
+	ListSubscribedEndpoints(ctx context.Context, eventType models.EventType) ([]*models.WebhookEndpoint, error)
+	UpdateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error
+	DeleteEndpoint(ctx context.Context, id uuid.UUID) error
+	ListSubscribedTenants(ctx context.Context, eventType models.EventType) ([]string, error)
+	CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) (bool, error)
+	GetDelivery(ctx context.Context, id uuid.UUID) (*models.WebhookDelivery, error)
+	ListDeliveries(ctx context.Context, endpointID uuid.UUID, limit int) ([]*models.WebhookDelivery, error)
+	ResetDelivery(ctx context.Context, id uuid.UUID) error
+	ClaimDue(ctx context.Context, lease time.Duration, limit int) ([]*models.DueWebhookDelivery, error)
+	RecordAttempt(ctx context.Context, id uuid.UUID, attempt *models.WebhookAttempt) error
+}
+
+const webhookEndpointColumns = "e.id, e.url, e.secret, e.event_types, e.active, e.created_at, e.updated_at"
+
+func scanWebhookEndpoint(row rowScanner) (*models.WebhookEndpoint, error) {
+	var endpoint models.WebhookEndpoint
+	err := row.Scan(
+		&endpoint.ID, &endpoint.URL, &endpoint.Secret, pq.Array(&endpoint.EventTypes), &endpoint.Active, &endpoint.CreatedAt, &endpoint.UpdatedAt,
+	)
+	return &endpoint, err
+}
+
+const webhookDeliveryColumns = `
+        d.id, d.endpoint_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at,
+        d.last_attempt_at, d.response_status, d.last_error, d.created_at
+    `
+
+func scanWebhookDelivery(row rowScanner, extra ...interface{}) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	var nextAttemptAt time.Time
+	dest := append([]interface{}{
+		&delivery.ID, &delivery.EndpointID, &delivery.EventID, &delivery.EventType, &delivery.Payload, &delivery.Status, &delivery.Attempts, &nextAttemptAt,
+		&delivery.LastAttemptAt, &delivery.ResponseStatus, &delivery.LastError, &delivery.CreatedAt,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	// Only pending deliveries are going to be attempted again.
+	if delivery.Status == models.DeliveryPending {
+		delivery.NextAttemptAt = &nextAttemptAt
+	}
+	return &delivery, nil
+}
+
+type webhookRepo struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) WebhookRepository {
+	return &webhookRepo{db: db}
+}
+
+func (r *webhookRepo) CreateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error {
+	query := `
+        INSERT INTO webhook_endpoints (id, tenant_id, url, secret, event_types, active, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    `
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		endpoint.ID, tenant.FromContext(ctx), endpoint.URL, endpoint.Secret, pq.Array(endpoint.EventTypes), endpoint.Active, endpoint.CreatedAt, endpoint.UpdatedAt,
+	)
+	return errors.Wrap(err, "failed to create webhook endpoint")
+}
+
+func (r *webhookRepo) GetEndpoint(ctx context.Context, id uuid.UUID) (*models.WebhookEndpoint, error) {
+	query := "SELECT " + webhookEndpointColumns + " FROM webhook_endpoints e WHERE e.id = $1 AND e.tenant_id = $2"
+
+	endpoint, err := scanWebhookEndpoint(conn(ctx, r.db).QueryRowContext(ctx, query, id, tenant.FromContext(ctx)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return endpoint, errors.Wrap(err, "failed to get webhook endpoint")
+}
+
+func (r *webhookRepo) ListEndpoints(ctx context.Context) ([]*models.WebhookEndpoint, error) {
+	query := "SELECT " + webhookEndpointColumns + " FROM webhook_endpoints e WHERE e.tenant_id = $1 ORDER BY e.created_at, e.id"
+	return r.listEndpoints(ctx, query, tenant.FromContext(ctx))
+}
+
+// ListSubscribedEndpoints returns the active endpoints of the tenant of ctx
+// that receive events of eventType.
+func (r *webhookRepo) ListSubscribedEndpoints(ctx context.Context, eventType models.EventType) ([]*models.WebhookEndpoint, error) {
+	query := "SELECT " + webhookEndpointColumns + ` FROM webhook_endpoints e
+        WHERE e.tenant_id = $1 AND e.active AND $2 = ANY(e.event_types)
+        ORDER BY e.created_at, e.id`
+	return r.listEndpoints(ctx, query, tenant.FromContext(ctx), string(eventType))
+}
+
+func (r *webhookRepo) listEndpoints(ctx context.Context, query string, args ...interface{}) ([]*models.WebhookEndpoint, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list webhook endpoints")
+	}
+	defer rows.Close()
+
+	var endpoints []*models.WebhookEndpoint
+	for rows.Next() {
+		endpoint, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan webhook endpoint")
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return endpoints, errors.Wrap(rows.Err(), "failed to iterate webhook endpoints")
+}
+
+func (r *webhookRepo) UpdateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error {
+	query := `
+        UPDATE webhook_endpoints SET url = $1, event_types = $2, active = $3, updated_at = $4
+        WHERE id = $5 AND tenant_id = $6
+    `
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		endpoint.URL, pq.Array(endpoint.EventTypes), endpoint.Active, endpoint.UpdatedAt, endpoint.ID, tenant.FromContext(ctx),
+	)
+	return errors.Wrap(err, "failed to update webhook endpoint")
+}
+
+// DeleteEndpoint deletes an endpoint together with its deliveries.
+func (r *webhookRepo) DeleteEndpoint(ctx context.Context, id uuid.UUID) error {
+	query := "DELETE FROM webhook_endpoints WHERE id = $1 AND tenant_id = $2"
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id, tenant.FromContext(ctx))
+	return errors.Wrap(err, "failed to delete webhook endpoint")
+}
+
+// ListSubscribedTenants returns the tenants with an active endpoint that
+// receives events of eventType. Like claiming, it works across tenants.
+func (r *webhookRepo) ListSubscribedTenants(ctx context.Context, eventType models.EventType) ([]string, error) {
+	query := "SELECT DISTINCT tenant_id FROM webhook_endpoints WHERE active AND $1 = ANY(event_types) ORDER BY tenant_id"
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, string(eventType))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list tenants with webhook endpoints")
+	}
+	defer rows.Close()
+
+	var tenants []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "failed to scan tenant")
+		}
+		tenants = append(tenants, id)
+	}
+
+	return tenants, errors.Wrap(rows.Err(), "failed to iterate tenants")
+}
+
+// CreateDelivery schedules the delivery of an event to an endpoint for
+// immediate delivery. It reports false without creating anything when the
+// event has already been delivered to the endpoint.
+func (r *webhookRepo) CreateDelivery(ctx context.Context, delivery *models.WebhookDelivery) (bool, error) {
+	query := `
+        INSERT INTO webhook_deliveries (id, tenant_id, endpoint_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+        ON CONFLICT (endpoint_id, event_id) DO NOTHING
+    `
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query,
+		delivery.ID, tenant.FromContext(ctx), delivery.EndpointID, delivery.EventID, delivery.EventType, []byte(delivery.Payload),
+		delivery.Status, delivery.CreatedAt,
+	)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to create webhook delivery")
+	}
+
+	rows, err := result.RowsAffected()
+	return rows > 0, errors.Wrap(err, "failed to create webhook delivery")
+}
+
+func (r *webhookRepo) GetDelivery(ctx context.Context, id uuid.UUID) (*models.WebhookDelivery, error) {
+	query := "SELECT " + webhookDeliveryColumns + " FROM webhook_deliveries d WHERE d.id = $1 AND d.tenant_id = $2"
+
+	delivery, err := scanWebhookDelivery(conn(ctx, r.db).QueryRowContext(ctx, query, id, tenant.FromContext(ctx)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return delivery, errors.Wrap(err, "failed to get webhook delivery")
+}
+
+// ListDeliveries returns the latest deliveries to an endpoint, newest
+// first.
+func (r *webhookRepo) ListDeliveries(ctx context.Context, endpointID uuid.UUID, limit int) ([]*models.WebhookDelivery, error) {
+	query := "SELECT " + webhookDeliveryColumns + ` FROM webhook_deliveries d
+        WHERE d.endpoint_id = $1 AND d.tenant_id = $2
+        ORDER BY d.created_at DESC, d.id DESC LIMIT $3`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, endpointID, tenant.FromContext(ctx), limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list webhook deliveries")
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan webhook delivery")
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, errors.Wrap(rows.Err(), "failed to iterate webhook deliveries")
+}
+
+// ResetDelivery makes a delivery pending again for immediate delivery with
+// a fresh set of attempts. The outcome of its last attempt is kept until
+// the next one.
+func (r *webhookRepo) ResetDelivery(ctx context.Context, id uuid.UUID) error {
+	query := `
+        UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = $2
+        WHERE id = $3 AND tenant_id = $4
+    `
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, models.DeliveryPending, time.Now(), id, tenant.FromContext(ctx))
+	return errors.Wrap(err, "failed to reset webhook delivery")
+}
+
+// ClaimDue claims up to limit pending deliveries to active endpoints that
+// are due, of all tenants, by postponing them by lease. Other instances
+// skip them until then, so that the lease has to outlast an attempt;
+// deliveries whose attempt was cut short are retried once it is over.
+func (r *webhookRepo) ClaimDue(ctx context.Context, lease time.Duration, limit int) ([]*models.DueWebhookDelivery, error) {
+	now := time.Now()
+	query := `
+        UPDATE webhook_deliveries d SET next_attempt_at = $1
+        FROM webhook_endpoints e
+        WHERE e.id = d.endpoint_id AND d.id IN (
+            SELECT pd.id FROM webhook_deliveries pd
+            JOIN webhook_endpoints pe ON pe.id = pd.endpoint_id
+            WHERE pd.status = $2 AND pd.next_attempt_at <= $3 AND pe.active
+            ORDER BY pd.next_attempt_at
+            LIMIT $4
+            FOR UPDATE OF pd SKIP LOCKED
+        )
+        RETURNING ` + webhookDeliveryColumns + `, d.tenant_id, e.url, e.secret
+    `
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, now.Add(lease), models.DeliveryPending, now, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to claim webhook deliveries")
+	}
+	defer rows.Close()
+
+	var due []*models.DueWebhookDelivery
+	for rows.Next() {
+		var claimed models.DueWebhookDelivery
+		claimed.Delivery, err = scanWebhookDelivery(rows, &claimed.TenantID, &claimed.URL, &claimed.Secret)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan webhook delivery")
+		}
+		due = append(due, &claimed)
+	}
+
+	return due, errors.Wrap(rows.Err(), "failed to iterate webhook deliveries")
+}
+
+// RecordAttempt stores the outcome of an attempt of a claimed delivery.
+func (r *webhookRepo) RecordAttempt(ctx context.Context, id uuid.UUID, attempt *models.WebhookAttempt) error {
+	query := `
+        UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, next_attempt_at = COALESCE($2, next_attempt_at),
+            last_attempt_at = $3, response_status = NULLIF($4, 0), last_error = NULLIF($5, '')
+        WHERE id = $6
+    `
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		attempt.Status, attempt.NextAttemptAt, time.Now(), attempt.ResponseStatus, attempt.Error, id,
+	)
+	return errors.Wrap(err, "failed to record webhook attempt")
+}
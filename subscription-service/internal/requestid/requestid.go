@@ -0,0 +1,16 @@
+package requestid
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithID returns a context carrying the id of the request it serves.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// FromContext returns the request id carried by ctx, or an empty string.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
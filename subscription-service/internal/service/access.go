@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"subscription-service/internal/auth"
+	"subscription-service/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrForbidden     = errors.New("forbidden")
+	ErrAdminRequired = errors.New("admin required")
+)
+
+// scopeFilter narrows filter down to the subscriptions of the caller when it
+// may only access its own. Asking for those of other users is forbidden.
+func scopeFilter(ctx context.Context, filter *models.SubscriptionFilter) error {
+	if filter.IncludeDeleted {
+		if err := authorizeIncludeDeleted(ctx); err != nil {
+			return err
+		}
+	}
+
+	p, ok := auth.Restricted(ctx)
+	if !ok {
+		return nil
+	}
+
+	for _, id := range filter.UserIDs {
+		if id != p.UserID {
+			return errors.Wrap(ErrForbidden, "subscriptions of other users are not accessible")
+		}
+	}
+
+	filter.UserIDs = []uuid.UUID{p.UserID}
+	return nil
+}
+
+// authorizeSubscription hides the subscriptions of other users from callers
+// that may only access their own.
+func authorizeSubscription(ctx context.Context, sub *models.Subscription) error {
+	if p, ok := auth.Restricted(ctx); ok && sub.UserID != p.UserID {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+// authorizeUser forbids callers that may only access their own data to act
+// on behalf of other users.
+func authorizeUser(ctx context.Context, userID uuid.UUID) error {
+	if p, ok := auth.Restricted(ctx); ok && userID != p.UserID {
+		return errors.Wrap(ErrForbidden, "cannot act on behalf of another user")
+	}
+	return nil
+}
+
+// authorizeIncludeDeleted lets only admins and API keys with the admin scope
+// see deleted subscriptions.
+func authorizeIncludeDeleted(ctx context.Context) error {
+	p, ok := auth.FromContext(ctx)
+	if !ok || p.Admin {
+		return nil
+	}
+	for _, scope := range p.Scopes {
+		if scope == models.ScopeAdmin {
+			return nil
+		}
+	}
+	return errors.Wrap(ErrAdminRequired, "only admins may see deleted subscriptions")
+}
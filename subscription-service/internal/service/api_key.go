@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"subscription-service/internal/auth"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+)
+
+// apiKeyPrefix starts every key so that leaked keys are easy to recognize.
+const apiKeyPrefix = "sk_"
+
+type APIKeyService interface {
+	IssueKey(ctx context.Context, req *models.IssueAPIKeyRequest) (*models.IssuedAPIKey, error)
+	ListKeys(ctx context.Context) ([]*models.APIKey, error)
+	RevokeKey(ctx context.Context, id uuid.UUID) error
+	Authenticate(ctx context.Context, key string) (*auth.Principal, error)
+}
+
+type apiKeyService struct {
+	repo repository.APIKeyRepository
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository) APIKeyService {
+	return &apiKeyService{repo: repo}
+}
+
+// IssueKey creates a key of the form sk_<prefix>_<secret> for the tenant of
+// ctx. Only its hash is stored, so the returned key cannot be recovered
+// later.
+func (s *apiKeyService) IssueKey(ctx context.Context, req *models.IssueAPIKeyRequest) (*models.IssuedAPIKey, error) {
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, errors.Wrap(ErrInvalidAPIKey, "expires_at must be in the future")
+	}
+
+	prefix, err := randomToken(4)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	issued := &models.IssuedAPIKey{
+		APIKey: models.APIKey{
+			ID:        uuid.New(),
+			Name:      strings.TrimSpace(req.Name),
+			Prefix:    prefix,
+			Scopes:    req.Scopes,
+			ExpiresAt: req.ExpiresAt,
+			CreatedAt: time.Now(),
+		},
+		Key: apiKeyPrefix + prefix + "_" + secret,
+	}
+
+	if err := s.repo.Create(ctx, &issued.APIKey, hashKey(issued.Key)); err != nil {
+		return nil, err
+	}
+
+	return issued, nil
+}
+
+func (s *apiKeyService) ListKeys(ctx context.Context) ([]*models.APIKey, error) {
+	keys, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		keys = []*models.APIKey{}
+	}
+
+	return keys, nil
+}
+
+func (s *apiKeyService) RevokeKey(ctx context.Context, id uuid.UUID) error {
+	key, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return ErrAPIKeyNotFound
+	}
+
+	return s.repo.Revoke(ctx, id)
+}
+
+// Authenticate returns the principal of a valid key, bound to the tenant of
+// the key, and records its use.
+func (s *apiKeyService) Authenticate(ctx context.Context, key string) (*auth.Principal, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	stored, err := s.repo.GetByHash(ctx, hashKey(key))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil || stored.RevokedAt != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if stored.ExpiresAt != nil && !stored.ExpiresAt.After(time.Now()) {
+		return nil, errors.Wrap(ErrInvalidAPIKey, "api key expired")
+	}
+
+	if err := s.repo.Touch(ctx, stored.ID); err != nil {
+		return nil, err
+	}
+
+	return &auth.Principal{APIKeyID: &stored.ID, Scopes: stored.Scopes, TenantID: stored.TenantID}, nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err, "failed to generate random token")
+	}
+	return hex.EncodeToString(buf), nil
+}
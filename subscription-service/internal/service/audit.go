@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"subscription-service/internal/auth"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/requestid"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+type AuditService interface {
+	ListEntries(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEntry, error)
+}
+
+type auditService struct {
+	repo repository.AuditRepository
+}
+
+func NewAuditService(repo repository.AuditRepository) AuditService {
+	return &auditService{repo: repo}
+}
+
+func (s *auditService) ListEntries(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEntry, error) {
+	if filter.Limit == 0 {
+		filter.Limit = models.DefaultAuditLimit
+	}
+
+	entries, err := s.repo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []*models.AuditEntry{}
+	}
+
+	return entries, nil
+}
+
+// unaudited lists the fields left out of audit diffs because they change
+// with every write or are derived rather than stored.
+var unaudited = map[string]bool{"updated_at": true, "next_billing_date": true}
+
+// recordChange appends the change of a subscription from before to after to
+// the audit log. before is nil for created subscriptions, after for deleted
+// ones. It has to be called within the transaction of the change so that the
+// entry is only kept along with it.
+func recordChange(ctx context.Context, audit repository.AuditRepository, action models.AuditAction, id uuid.UUID, before, after *models.Subscription) error {
+	changes, err := diff(before, after)
+	if err != nil {
+		return err
+	}
+
+	entry := &models.AuditEntry{
+		EntityType: models.AuditEntitySubscription,
+		EntityID:   id,
+		Action:     action,
+		Actor:      auth.Actor(ctx),
+		Changes:    changes,
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		entry.RequestID = &id
+	}
+
+	return audit.Append(ctx, entry)
+}
+
+// recordChanges records the changes of a statement that changed many
+// subscriptions at once, one entry and one event per subscription, like the
+// changes of subscriptions one by one. Deletions are recorded without the
+// subscription they leave behind.
+func recordChanges(ctx context.Context, audit repository.AuditRepository, outbox repository.OutboxRepository, action models.AuditAction, changes []*models.SubscriptionChange) error {
+	for _, change := range changes {
+		after := change.After
+		if action == models.AuditDelete {
+			after = nil
+		}
+		if err := recordChange(ctx, audit, action, change.Before.ID, change.Before, after); err != nil {
+			return err
+		}
+		if err := appendChangeEvent(ctx, outbox, action, change.Before, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diff compares the JSON representations of before and after field by
+// field. Either may be nil.
+func diff(before, after interface{}) (map[string]models.FieldChange, error) {
+	old, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]models.FieldChange{}
+	for name, value := range old {
+		if !unaudited[name] && !reflect.DeepEqual(value, updated[name]) {
+			changes[name] = models.FieldChange{Old: value, New: updated[name]}
+		}
+	}
+	for name, value := range updated {
+		if _, ok := old[name]; !ok && !unaudited[name] {
+			changes[name] = models.FieldChange{New: value}
+		}
+	}
+
+	return changes, nil
+}
+
+func fields(value interface{}) (map[string]interface{}, error) {
+	if v := reflect.ValueOf(value); !v.IsValid() || v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode audited value")
+	}
+
+	var result map[string]interface{}
+	return result, errors.Wrap(json.Unmarshal(data, &result), "failed to decode audited value")
+}
+
+// changeEvents maps recorded changes of subscriptions to the events
+// published for them. Purges follow deletions, which were published
+// already.
+var changeEvents = map[models.AuditAction]models.EventType{
+	models.AuditCreate:  models.EventSubscriptionCreated,
+	models.AuditUpdate:  models.EventSubscriptionUpdated,
+	models.AuditPause:   models.EventSubscriptionUpdated,
+	models.AuditResume:  models.EventSubscriptionUpdated,
+	models.AuditCancel:  models.EventSubscriptionUpdated,
+	models.AuditRestore: models.EventSubscriptionUpdated,
+	models.AuditDelete:  models.EventSubscriptionDeleted,
+}
+
+// recordChange records the change of a subscription like the function of
+// the same name and appends its event to the outbox, within the
+// transaction of the change.
+func (s *subscriptionService) recordChange(ctx context.Context, action models.AuditAction, id uuid.UUID, before, after *models.Subscription) error {
+	if err := recordChange(ctx, s.audit, action, id, before, after); err != nil {
+		return err
+	}
+	return appendChangeEvent(ctx, s.outbox, action, before, after)
+}
+
+// appendChangeEvent appends the event published for the change of a
+// subscription to the outbox. It has to be called within the transaction of
+// the change, like recordChange.
+func appendChangeEvent(ctx context.Context, outbox repository.OutboxRepository, action models.AuditAction, before, after *models.Subscription) error {
+	eventType, ok := changeEvents[action]
+	if !ok {
+		return nil
+	}
+	subscription := after
+	if subscription == nil {
+		subscription = before
+	}
+	return outbox.Append(ctx, &models.Event{
+		ID:        uuid.New(),
+		Type:      eventType,
+		CreatedAt: time.Now(),
+		Data:      models.EventData{Subscription: subscription},
+	})
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"subscription-service/internal/auth"
+	"subscription-service/internal/models"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidBatch = errors.New("invalid batch operation")
+
+// batchOperations maps the batch operations to the operations of the access
+// policy they are authorized as.
+var batchOperations = map[models.BatchOp]auth.Operation{
+	models.BatchCreate: auth.OpSubscriptionsCreate,
+	models.BatchUpdate: auth.OpSubscriptionsUpdate,
+	models.BatchDelete: auth.OpSubscriptionsDelete,
+}
+
+// ExecuteBatch applies the operations of req in order. All operations are
+// validated before any is applied. Atomic batches are applied in a single
+// transaction and only if every operation is valid; the first failing
+// operation rolls back the others. Best-effort batches apply every valid
+// operation on its own. The error is only set when the batch as a whole
+// could not be run.
+func (s *subscriptionService) ExecuteBatch(ctx context.Context, req *models.BatchRequest) (*models.BatchResponse, error) {
+	response := &models.BatchResponse{Mode: req.Mode, Results: make([]*models.BatchItemResult, len(req.Operations))}
+	if response.Mode == "" {
+		response.Mode = models.BatchAtomic
+	}
+
+	valid := true
+	for i := range req.Operations {
+		op := &req.Operations[i]
+		response.Results[i] = &models.BatchItemResult{Index: i, Op: op.Op, ID: op.ID}
+		if err := validateOperation(ctx, op); err != nil {
+			response.Results[i].Status, response.Results[i].Err = models.BatchItemFailed, err
+			valid = false
+		}
+	}
+
+	if response.Mode == models.BatchBestEffort {
+		for i := range req.Operations {
+			if result := response.Results[i]; result.Status != models.BatchItemFailed {
+				s.applyOperation(ctx, &req.Operations[i], result)
+			}
+		}
+	} else if valid {
+		failed := -1
+		err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+			for i := range req.Operations {
+				if err := s.applyOperation(ctx, &req.Operations[i], response.Results[i]); err != nil {
+					failed = i
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil && failed < 0 {
+			return nil, err
+		}
+		for _, result := range response.Results[:max(failed, 0)] {
+			result.Status, result.Subscription = models.BatchItemRolledBack, nil
+			if result.Op == models.BatchCreate {
+				result.ID = nil
+			}
+		}
+	}
+
+	for _, result := range response.Results {
+		switch result.Status {
+		case models.BatchItemApplied:
+			response.Applied++
+		case models.BatchItemFailed:
+			response.Failed++
+		case "":
+			result.Status = models.BatchItemSkipped
+		}
+	}
+
+	return response, nil
+}
+
+// validateOperation checks that op is complete and permitted before
+// anything is applied.
+func validateOperation(ctx context.Context, op *models.BatchOperation) error {
+	operation, ok := batchOperations[op.Op]
+	if !ok {
+		return errors.Wrapf(ErrInvalidBatch, "unknown operation %q", op.Op)
+	}
+	if p, ok := auth.FromContext(ctx); ok {
+		if denial := auth.Authorize(p, operation); denial != nil {
+			return errors.Wrap(ErrForbidden, denial.Message)
+		}
+	}
+
+	var payload interface{}
+	switch op.Op {
+	case models.BatchCreate:
+		if op.Create == nil {
+			return errors.Wrap(ErrInvalidBatch, "create operations need create")
+		}
+		payload = op.Create
+	case models.BatchUpdate:
+		if op.ID == nil || op.Update == nil {
+			return errors.Wrap(ErrInvalidBatch, "update operations need id and update")
+		}
+		payload = op.Update
+	case models.BatchDelete:
+		if op.ID == nil {
+			return errors.Wrap(ErrInvalidBatch, "delete operations need id")
+		}
+		return nil
+	}
+
+	if err := binding.Validator.ValidateStruct(payload); err != nil {
+		return errors.Wrap(ErrInvalidBatch, err.Error())
+	}
+	return nil
+}
+
+// applyOperation applies a validated operation and records its outcome in
+// result.
+func (s *subscriptionService) applyOperation(ctx context.Context, op *models.BatchOperation, result *models.BatchItemResult) error {
+	var err error
+	switch op.Op {
+	case models.BatchCreate:
+		result.Subscription, err = s.CreateSubscription(ctx, op.Create)
+		if err == nil {
+			result.ID = &result.Subscription.ID
+		}
+	case models.BatchUpdate:
+		result.Subscription, err = s.UpdateSubscription(ctx, *op.ID, op.Update, op.Version)
+	case models.BatchDelete:
+		err = s.DeleteSubscription(ctx, *op.ID, op.Version)
+	}
+
+	if err != nil {
+		result.Status, result.Err = models.BatchItemFailed, err
+		return err
+	}
+	result.Status = models.BatchItemApplied
+	return nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"subscription-service/internal/models"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidBilling = errors.New("invalid billing settings")
+
+// periodMonths is the length in months of the fixed billing periods.
+var periodMonths = map[models.BillingPeriod]int{
+	models.BillingMonthly:   1,
+	models.BillingQuarterly: 3,
+	models.BillingYearly:    12,
+}
+
+// applyBilling validates the billing settings and stores them on sub, filling
+// in the interval of fixed periods and the default anchor day. Zero values
+// stand for settings that were not given.
+func applyBilling(sub *models.Subscription, period models.BillingPeriod, interval, anchorDay int) error {
+	if period == "" {
+		period = models.BillingMonthly
+	}
+
+	switch period {
+	case models.BillingWeekly:
+		if interval > 1 {
+			return errors.Wrap(ErrInvalidBilling, "billing_interval is only supported for custom billing")
+		}
+		interval = 1
+		if anchorDay == 0 {
+			anchorDay = isoWeekday(sub.StartDate)
+		}
+		if anchorDay > 7 {
+			return errors.Wrap(ErrInvalidBilling, "billing_anchor_day of weekly billing must be an ISO weekday between 1 and 7")
+		}
+	case models.BillingCustom:
+		if interval == 0 {
+			return errors.Wrap(ErrInvalidBilling, "billing_interval is required for custom billing")
+		}
+	default:
+		months, ok := periodMonths[period]
+		if !ok {
+			return errors.Wrapf(ErrInvalidBilling, "unknown billing period %q", period)
+		}
+		if interval != 0 && interval != months {
+			return errors.Wrap(ErrInvalidBilling, "billing_interval is only supported for custom billing")
+		}
+		interval = months
+	}
+
+	if anchorDay == 0 {
+		anchorDay = 1
+	}
+
+	sub.BillingPeriod = period
+	sub.BillingInterval = interval
+	sub.BillingAnchorDay = anchorDay
+	return nil
+}
+
+// nextBillingDate returns the date of the first charge on or after now, or
+// nil when the subscription is not billed anymore.
+func nextBillingDate(sub *models.Subscription, now time.Time) *time.Time {
+	if sub.Status != models.StatusActive && sub.Status != models.StatusTrial {
+		return nil
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var next time.Time
+	if sub.BillingPeriod == models.BillingWeekly {
+		next = firstChargeDate(sub)
+		if today.After(next) {
+			days := int(today.Sub(next).Hours() / 24)
+			next = next.AddDate(0, 0, (days+6)/7*7)
+		}
+	} else {
+		start := startOfMonth(sub.StartDate)
+		months := (today.Year()-start.Year())*12 + int(today.Month()-start.Month())
+		if months < 0 {
+			months = 0
+		}
+		elapsed := months / sub.BillingInterval * sub.BillingInterval
+		next = chargeDate(start.AddDate(0, elapsed, 0), sub.BillingAnchorDay)
+		if next.Before(today) {
+			next = chargeDate(start.AddDate(0, elapsed+sub.BillingInterval, 0), sub.BillingAnchorDay)
+		}
+	}
+
+	if sub.EndDate != nil && !next.Before(startOfMonth(*sub.EndDate).AddDate(0, 1, 0)) {
+		return nil
+	}
+
+	return &next
+}
+
+// firstChargeDate returns the date of the first charge of sub.
+func firstChargeDate(sub *models.Subscription) time.Time {
+	if sub.BillingPeriod == models.BillingWeekly {
+		return sub.StartDate.AddDate(0, 0, (sub.BillingAnchorDay-isoWeekday(sub.StartDate)+7)%7)
+	}
+	return chargeDate(startOfMonth(sub.StartDate), sub.BillingAnchorDay)
+}
+
+// chargeDate returns the anchor day of month, moved to the last day of the
+// month when the month is shorter.
+func chargeDate(month time.Time, anchorDay int) time.Time {
+	if last := month.AddDate(0, 1, -1).Day(); anchorDay > last {
+		anchorDay = last
+	}
+	return time.Date(month.Year(), month.Month(), anchorDay, 0, 0, 0, 0, time.UTC)
+}
+
+func isoWeekday(t time.Time) int {
+	if t.Weekday() == time.Sunday {
+		return 7
+	}
+	return int(t.Weekday())
+}
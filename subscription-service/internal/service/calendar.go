@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"subscription-service/internal/models"
+	"subscription-service/internal/tenant"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidCalendarToken = errors.New("invalid calendar token")
+
+// calendarTokenPrefix starts every calendar token so that leaked tokens are
+// easy to recognize.
+const calendarTokenPrefix = "cal_"
+
+// IssueCalendarToken gives the user a new calendar token, replacing the
+// previous one. Only its hash is stored, so the returned token cannot be
+// recovered later.
+func (s *userService) IssueCalendarToken(ctx context.Context, id uuid.UUID) (string, error) {
+	if err := authorizeUser(ctx, id); err != nil {
+		return "", err
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	token := calendarTokenPrefix + secret
+
+	hash := hashKey(token)
+	ok, err := s.repo.SetCalendarToken(ctx, id, &hash)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrUserNotFound
+	}
+
+	return token, nil
+}
+
+// RevokeCalendarToken removes the calendar token of the user, which closes
+// its charges feed.
+func (s *userService) RevokeCalendarToken(ctx context.Context, id uuid.UUID) error {
+	if err := authorizeUser(ctx, id); err != nil {
+		return err
+	}
+
+	ok, err := s.repo.SetCalendarToken(ctx, id, nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// GetChargeSchedule returns the charges of the billed subscriptions of the
+// user owning token, who has to be the user with the given id. It needs no
+// principal or tenant: both follow from the token.
+func (s *userService) GetChargeSchedule(ctx context.Context, id uuid.UUID, token string) (*models.User, []*models.ChargeSeries, error) {
+	if !strings.HasPrefix(token, calendarTokenPrefix) {
+		return nil, nil, ErrInvalidCalendarToken
+	}
+
+	user, tenantID, err := s.repo.GetByCalendarToken(ctx, hashKey(token))
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil || user.ID != id {
+		return nil, nil, ErrInvalidCalendarToken
+	}
+	ctx = tenant.WithID(ctx, tenantID)
+
+	now := time.Now()
+	filter := &models.SubscriptionFilter{UserIDs: []uuid.UUID{id}}
+	opts := &models.ListOptions{Sort: models.SortByStartDate, Order: models.SortAsc}
+
+	schedule := []*models.ChargeSeries{}
+	err = s.subscriptions.Each(ctx, filter, opts, func(sub *models.Subscription) error {
+		present(sub, now)
+		if sub.Status != models.StatusActive && sub.Status != models.StatusTrial {
+			return nil
+		}
+
+		series := &models.ChargeSeries{Subscription: sub, First: firstChargeDate(sub)}
+		if sub.EndDate != nil {
+			// Subscriptions are billed up to the end of their last month.
+			until := startOfMonth(*sub.EndDate).AddDate(0, 1, -1)
+			series.Until = &until
+		}
+		schedule = append(schedule, series)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, schedule, nil
+}
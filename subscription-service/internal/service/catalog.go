@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrServiceNotFound = errors.New("service not found")
+	ErrServiceConflict = errors.New("service name or alias already taken")
+)
+
+type CatalogService interface {
+	CreateService(ctx context.Context, req *models.CreateServiceRequest) (*models.Service, error)
+	GetService(ctx context.Context, id uuid.UUID) (*models.Service, error)
+	UpdateService(ctx context.Context, id uuid.UUID, req *models.UpdateServiceRequest) (*models.Service, error)
+	DeleteService(ctx context.Context, id uuid.UUID) error
+	ListServices(ctx context.Context, category string) ([]*models.Service, error)
+}
+
+type catalogService struct {
+	repo   repository.ServiceRepository
+	audit  repository.AuditRepository
+	outbox repository.OutboxRepository
+	tx     repository.Transactor
+}
+
+// NewCatalogService creates the catalog service. Subscriptions renamed,
+// linked or unlinked along with services are recorded in the audit log and
+// their events appended to outbox.
+func NewCatalogService(repo repository.ServiceRepository, audit repository.AuditRepository, outbox repository.OutboxRepository, tx repository.Transactor) CatalogService {
+	return &catalogService{repo: repo, audit: audit, outbox: outbox, tx: tx}
+}
+
+func (s *catalogService) CreateService(ctx context.Context, req *models.CreateServiceRequest) (*models.Service, error) {
+	svc := &models.Service{
+		ID:           uuid.New(),
+		Name:         strings.TrimSpace(req.Name),
+		Category:     strings.TrimSpace(req.Category),
+		DefaultPrice: req.DefaultPrice,
+		Currency:     req.Currency,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	svc.Aliases = normalizeAliases(svc.Name, req.Aliases)
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.checkNames(ctx, svc.ID, svc.Name, svc.Aliases); err != nil {
+			return err
+		}
+		if err := s.repo.Create(ctx, svc); err != nil {
+			return err
+		}
+		return s.linkSubscriptions(ctx, svc)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return svc, nil
+}
+
+func (s *catalogService) GetService(ctx context.Context, id uuid.UUID) (*models.Service, error) {
+	svc, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get service from repository")
+	}
+	if svc == nil {
+		return nil, ErrServiceNotFound
+	}
+	return svc, nil
+}
+
+func (s *catalogService) UpdateService(ctx context.Context, id uuid.UUID, req *models.UpdateServiceRequest) (*models.Service, error) {
+	var svc *models.Service
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		current, err := s.GetService(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		name := current.Name
+		if req.Name != nil {
+			name = strings.TrimSpace(*req.Name)
+			req.Name = &name
+		}
+		aliases := current.Aliases
+		if req.Aliases != nil {
+			aliases = *req.Aliases
+		}
+		// Aliases are normalized against the final name even when only the
+		// name changes, so a renamed service never keeps its name as an alias.
+		aliases = normalizeAliases(name, aliases)
+		req.Aliases = &aliases
+
+		if err := s.checkNames(ctx, id, name, aliases); err != nil {
+			return err
+		}
+		if err := s.repo.Update(ctx, id, req); err != nil {
+			return err
+		}
+
+		if svc, err = s.GetService(ctx, id); err != nil {
+			return err
+		}
+		return s.linkSubscriptions(ctx, svc)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return svc, nil
+}
+
+// DeleteService removes a service from the catalog. Its subscriptions keep
+// the canonical name they were given but are no longer linked to a service;
+// their changes are recorded like those of linked subscriptions.
+func (s *catalogService) DeleteService(ctx context.Context, id uuid.UUID) error {
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := s.GetService(ctx, id); err != nil {
+			return err
+		}
+
+		changes, err := s.repo.UnlinkSubscriptions(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := recordChanges(ctx, s.audit, s.outbox, models.AuditUpdate, changes); err != nil {
+			return err
+		}
+
+		return s.repo.Delete(ctx, id)
+	})
+}
+
+// linkSubscriptions links the subscriptions of svc and records their
+// changes.
+func (s *catalogService) linkSubscriptions(ctx context.Context, svc *models.Service) error {
+	changes, err := s.repo.LinkSubscriptions(ctx, svc)
+	if err != nil {
+		return err
+	}
+	return recordChanges(ctx, s.audit, s.outbox, models.AuditUpdate, changes)
+}
+
+func (s *catalogService) ListServices(ctx context.Context, category string) ([]*models.Service, error) {
+	services, err := s.repo.List(ctx, strings.TrimSpace(category))
+	if err != nil {
+		return nil, err
+	}
+	if services == nil {
+		services = []*models.Service{}
+	}
+
+	return services, nil
+}
+
+// checkNames makes sure that neither the name nor any alias of the service id
+// resolves to another service.
+func (s *catalogService) checkNames(ctx context.Context, id uuid.UUID, name string, aliases []string) error {
+	for _, n := range append([]string{name}, aliases...) {
+		other, err := s.repo.Resolve(ctx, n)
+		if err != nil {
+			return err
+		}
+		if other != nil && other.ID != id {
+			return errors.Wrapf(ErrServiceConflict, "%q is used by service %s", n, other.Name)
+		}
+	}
+	return nil
+}
+
+// normalizeAliases trims the aliases and drops empty ones, case-insensitive
+// duplicates and those equal to the name.
+func normalizeAliases(name string, aliases []string) []string {
+	seen := map[string]bool{strings.ToLower(name): true}
+	result := []string{}
+	for _, alias := range aliases {
+		alias = strings.TrimSpace(alias)
+		key := strings.ToLower(alias)
+		if alias == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, alias)
+	}
+	return result
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"subscription-service/internal/models"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func encodeCursor(cursor *models.PageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor decodes a cursor and checks that its value is a valid sort
+// key of its sort field, so that tampered cursors never reach the database.
+func decodeCursor(value string) (*models.PageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode cursor")
+	}
+
+	var cursor models.PageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal cursor")
+	}
+
+	switch cursor.Sort {
+	case models.SortByPrice:
+		_, err = strconv.Atoi(cursor.Value)
+	case models.SortByStartDate:
+		_, err = time.Parse("2006-01-02", cursor.Value)
+	case models.SortByServiceName:
+	case models.SortByCreatedAt:
+		_, err = time.Parse(time.RFC3339Nano, cursor.Value)
+	default:
+		err = errors.Errorf("unsupported sort field %q", cursor.Sort)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid cursor value")
+	}
+
+	return &cursor, nil
+}
+
+// cursorValue renders the sort key of a subscription in a form Postgres can
+// cast back to the type of the sorted column.
+func cursorValue(sub *models.Subscription, sort string) string {
+	switch sort {
+	case models.SortByPrice:
+		return strconv.Itoa(sub.Price)
+	case models.SortByStartDate:
+		return sub.StartDate.Format("2006-01-02")
+	case models.SortByServiceName:
+		return sub.ServiceName
+	default:
+		return sub.CreatedAt.Format(time.RFC3339Nano)
+	}
+}
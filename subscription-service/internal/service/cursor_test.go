@@ -0,0 +1,37 @@
+package service
+
+import (
+	"subscription-service/internal/models"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	sub := &models.Subscription{
+		ID:          uuid.New(),
+		ServiceName: "Netflix",
+		Price:       100,
+		StartDate:   time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+		CreatedAt:   time.Now(),
+	}
+	for _, sort := range []string{models.SortByCreatedAt, models.SortByPrice, models.SortByStartDate, models.SortByServiceName} {
+		value := encodeCursor(&models.PageCursor{Sort: sort, Order: models.SortAsc, Value: cursorValue(sub, sort), ID: sub.ID})
+		if _, err := decodeCursor(value); err != nil {
+			t.Errorf("decodeCursor() of a %s cursor = %v", sort, err)
+		}
+	}
+
+	tampered := map[string]*models.PageCursor{
+		"price":      {Sort: models.SortByPrice, Value: "abc"},
+		"start date": {Sort: models.SortByStartDate, Value: "2024-13-01"},
+		"created at": {Sort: models.SortByCreatedAt, Value: "yesterday"},
+		"sort":       {Sort: "user_id", Value: "1"},
+	}
+	for name, cursor := range tampered {
+		if _, err := decodeCursor(encodeCursor(cursor)); err == nil {
+			t.Errorf("decodeCursor() accepted a cursor with a tampered %s", name)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"subscription-service/internal/auth"
+	"subscription-service/internal/models"
+	"subscription-service/internal/tenant"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// eventStreamBuffer is the number of events a stream may fall behind before
+// it is closed.
+const eventStreamBuffer = 64
+
+// EventStream receives the events of a broker matching a filter.
+type EventStream struct {
+	// Replay holds the retained events that followed the event a stream
+	// resumes from. Reset is set instead when that event is no longer
+	// retained, so that events may have been missed.
+	Replay []*models.Event
+	Reset  bool
+	// Events receives the events sent to the broker from then on. It is
+	// closed when the stream falls behind or the broker is closed.
+	Events <-chan *models.Event
+
+	close func()
+}
+
+// Close stops the delivery of events to s.
+func (s *EventStream) Close() {
+	s.close()
+}
+
+// EventBroker is the sink of an outbox tail that fans events out to the
+// streams of clients. It retains the last events it received so that
+// streams can resume after reconnecting. As every instance of the service
+// tails the whole outbox, streams see the events of all instances and can
+// resume on any of them.
+type EventBroker interface {
+	Sink
+	Subscribe(ctx context.Context, filter *models.EventFilter, lastEventID *uuid.UUID) (*EventStream, error)
+	Close()
+}
+
+type eventSubscriber struct {
+	tenantID string
+	filter   *models.EventFilter
+	events   chan *models.Event
+}
+
+type eventBroker struct {
+	mu sync.Mutex
+	// history is a ring of the retained events, the oldest at next.
+	history     []*models.OutboxEvent
+	next        int
+	retained    map[uuid.UUID]struct{}
+	subscribers map[*eventSubscriber]struct{}
+	closed      bool
+}
+
+// NewEventBroker creates a broker that retains the given number of events.
+func NewEventBroker(history int) EventBroker {
+	return &eventBroker{
+		history:     make([]*models.OutboxEvent, history),
+		retained:    make(map[uuid.UUID]struct{}),
+		subscribers: make(map[*eventSubscriber]struct{}),
+	}
+}
+
+// Send retains event and passes it to the matching streams. Events it
+// already retains are dropped as duplicates. Streams that cannot take the
+// event are closed rather than holding up the tail; their clients resume
+// from the history.
+func (b *eventBroker) Send(ctx context.Context, event *models.OutboxEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.retained[event.ID]; ok {
+		return nil
+	}
+	if oldest := b.history[b.next]; oldest != nil {
+		delete(b.retained, oldest.ID)
+	}
+	b.history[b.next] = event
+	b.next = (b.next + 1) % len(b.history)
+	b.retained[event.ID] = struct{}{}
+
+	for sub := range b.subscribers {
+		if !sub.matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- &event.Event:
+		default:
+			b.unsubscribe(sub)
+		}
+	}
+	return nil
+}
+
+// Subscribe opens a stream of the events of the tenant of ctx that match
+// filter. Members only receive the events of their own subscriptions. When
+// lastEventID is given, the retained events that followed it are replayed.
+func (b *eventBroker) Subscribe(ctx context.Context, filter *models.EventFilter, lastEventID *uuid.UUID) (*EventStream, error) {
+	if p, ok := auth.Restricted(ctx); ok {
+		for _, id := range filter.UserIDs {
+			if id != p.UserID {
+				return nil, errors.Wrap(ErrForbidden, "subscriptions of other users are not accessible")
+			}
+		}
+		filter.UserIDs = []uuid.UUID{p.UserID}
+	}
+
+	sub := &eventSubscriber{
+		tenantID: tenant.FromContext(ctx),
+		filter:   filter,
+		events:   make(chan *models.Event, eventStreamBuffer),
+	}
+	stream := &EventStream{Events: sub.events}
+	stream.close = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.unsubscribe(sub)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(sub.events)
+		return stream, nil
+	}
+
+	if lastEventID != nil {
+		if _, ok := b.retained[*lastEventID]; !ok {
+			stream.Reset = true
+		} else {
+			found := false
+			b.each(func(event *models.OutboxEvent) {
+				if found && sub.matches(event) {
+					stream.Replay = append(stream.Replay, &event.Event)
+				}
+				if event.ID == *lastEventID {
+					found = true
+				}
+			})
+		}
+	}
+
+	b.subscribers[sub] = struct{}{}
+	return stream, nil
+}
+
+// Close closes every stream and those opened from then on.
+func (b *eventBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subscribers {
+		b.unsubscribe(sub)
+	}
+}
+
+// each calls fn with the retained events, oldest first. b.mu must be held.
+func (b *eventBroker) each(fn func(event *models.OutboxEvent)) {
+	for i := range b.history {
+		if event := b.history[(b.next+i)%len(b.history)]; event != nil {
+			fn(event)
+		}
+	}
+}
+
+// unsubscribe removes sub and closes its stream. b.mu must be held.
+func (b *eventBroker) unsubscribe(sub *eventSubscriber) {
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+func (s *eventSubscriber) matches(event *models.OutboxEvent) bool {
+	sub := event.Data.Subscription
+	if event.TenantID != s.tenantID || sub == nil {
+		return false
+	}
+
+	if len(s.filter.UserIDs) > 0 {
+		found := false
+		for _, id := range s.filter.UserIDs {
+			if id == sub.UserID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if s.filter.ServiceName != nil {
+		return strings.Contains(strings.ToLower(sub.ServiceName), strings.ToLower(*s.filter.ServiceName))
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"os"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidExchangeRate = errors.New("invalid exchange rate")
+
+type ExchangeRateService interface {
+	SetRates(ctx context.Context, req *models.SetExchangeRatesRequest) ([]*models.ExchangeRate, error)
+	ListRates(ctx context.Context, baseCurrency, quoteCurrency string) ([]*models.ExchangeRate, error)
+	LoadFile(ctx context.Context, path string) (int, error)
+}
+
+type exchangeRateService struct {
+	repo repository.ExchangeRateRepository
+	tx   repository.Transactor
+}
+
+func NewExchangeRateService(repo repository.ExchangeRateRepository, tx repository.Transactor) ExchangeRateService {
+	return &exchangeRateService{repo: repo, tx: tx}
+}
+
+// SetRates stores the given rates, replacing rates known for the same
+// currency pair and month.
+func (s *exchangeRateService) SetRates(ctx context.Context, req *models.SetExchangeRatesRequest) ([]*models.ExchangeRate, error) {
+	rates := make([]*models.ExchangeRate, 0, len(req.Rates))
+	for _, input := range req.Rates {
+		month, err := time.Parse("01-2006", input.Month)
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidExchangeRate, "invalid month format for %s/%s", input.BaseCurrency, input.QuoteCurrency)
+		}
+
+		rates = append(rates, &models.ExchangeRate{
+			ID:            uuid.New(),
+			BaseCurrency:  input.BaseCurrency,
+			QuoteCurrency: input.QuoteCurrency,
+			Month:         month,
+			Rate:          input.Rate,
+		})
+	}
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		for _, rate := range rates {
+			if err := s.repo.Upsert(ctx, rate); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rates, nil
+}
+
+func (s *exchangeRateService) ListRates(ctx context.Context, baseCurrency, quoteCurrency string) ([]*models.ExchangeRate, error) {
+	rates, err := s.repo.List(ctx, baseCurrency, quoteCurrency)
+	if err != nil {
+		return nil, err
+	}
+	if rates == nil {
+		rates = []*models.ExchangeRate{}
+	}
+	return rates, nil
+}
+
+// LoadFile stores the rates listed in a YAML or JSON file shaped like
+// models.SetExchangeRatesRequest and returns how many were loaded.
+func (s *exchangeRateService) LoadFile(ctx context.Context, path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to open exchange rates file")
+	}
+	defer file.Close()
+
+	var req models.SetExchangeRatesRequest
+	if err := yaml.NewDecoder(file).Decode(&req); err != nil {
+		return 0, errors.Wrap(err, "failed to decode exchange rates file")
+	}
+
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return 0, errors.Wrap(err, "invalid exchange rates file")
+	}
+
+	rates, err := s.SetRates(ctx, &req)
+	return len(rates), err
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"subscription-service/internal/models"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidImport = errors.New("invalid import")
+
+// importFields lists the fields of models.CreateSubscriptionRequest uploads
+// can set and whether they hold integers.
+var importFields = map[string]bool{
+	"service_name":       false,
+	"price":              true,
+	"currency":           false,
+	"user_id":            false,
+	"start_date":         false,
+	"end_date":           false,
+	"status":             false,
+	"billing_period":     false,
+	"billing_interval":   true,
+	"billing_anchor_day": true,
+}
+
+// maxNDJSONLine caps the length of a single NDJSON record.
+const maxNDJSONLine = 1 << 20
+
+// importRecord is a row of an upload by column name or key, or the error
+// that kept it from being read.
+type importRecord struct {
+	values map[string]interface{}
+	err    error
+}
+
+// ImportSubscriptions creates a subscription from every row of an upload.
+// Rows are validated like requests to CreateSubscription. Nothing is written
+// on dry runs or when any row is invalid; otherwise all rows are written in
+// a single transaction. The error is only set when the upload as a whole
+// cannot be read.
+func (s *subscriptionService) ImportSubscriptions(ctx context.Context, r io.Reader, opts *models.ImportOptions) (*models.ImportReport, error) {
+	for field := range opts.Mapping {
+		if _, ok := importFields[field]; !ok {
+			return nil, errors.Wrapf(ErrInvalidImport, "cannot map unknown field %q", field)
+		}
+	}
+
+	var records []importRecord
+	var err error
+	switch opts.Format {
+	case models.ImportCSV:
+		records, err = decodeCSV(r)
+	case models.ImportNDJSON:
+		records, err = decodeNDJSON(r)
+	default:
+		err = errors.Wrapf(ErrInvalidImport, "unsupported format %q", opts.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.ImportReport{DryRun: opts.DryRun, Rows: len(records), Results: make([]*models.ImportRowResult, len(records))}
+	prepared := make([]*models.Subscription, len(records))
+	for i, record := range records {
+		result := &models.ImportRowResult{Row: i + 1}
+		report.Results[i] = result
+
+		err := record.err
+		if err == nil {
+			prepared[i], err = s.prepareRecord(ctx, record, opts.Mapping)
+		}
+		if err != nil {
+			result.Error = err.Error()
+			report.Invalid++
+			continue
+		}
+		result.Valid = true
+		report.Valid++
+	}
+
+	if opts.DryRun || report.Invalid > 0 {
+		return report, nil
+	}
+
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		for i, subscription := range prepared {
+			if err := s.insertSubscription(ctx, subscription); err != nil {
+				return errors.Wrapf(err, "failed to import row %d", i+1)
+			}
+			report.Results[i].ID = &subscription.ID
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Imported = len(prepared)
+	return report, nil
+}
+
+// prepareRecord turns a record into a request through mapping and prepares
+// the subscription it asks for.
+func (s *subscriptionService) prepareRecord(ctx context.Context, record importRecord, mapping map[string]string) (*models.Subscription, error) {
+	fields := map[string]interface{}{}
+	for field, integer := range importFields {
+		source := field
+		if column, ok := mapping[field]; ok {
+			source = column
+		}
+
+		value, ok := record.values[source]
+		if !ok || value == nil || value == "" {
+			continue
+		}
+
+		if integer {
+			n, err := toInt(value)
+			if err != nil {
+				return nil, errors.Errorf("%s must be an integer", field)
+			}
+			fields[field] = n
+		} else if text, ok := value.(string); ok {
+			fields[field] = strings.TrimSpace(text)
+		} else {
+			return nil, errors.Errorf("%s must be a string", field)
+		}
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode row")
+	}
+	var req models.CreateSubscriptionRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, errors.Wrap(err, "invalid row")
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return nil, err
+	}
+
+	return s.prepareSubscription(ctx, &req)
+}
+
+func toInt(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, errors.New("not an integer")
+		}
+		return int(v), nil
+	case string:
+		return strconv.Atoi(strings.TrimSpace(v))
+	default:
+		return 0, errors.New("not an integer")
+	}
+}
+
+// decodeCSV reads CSV with a header row naming the columns. Rows with the
+// wrong number of columns are reported as invalid.
+func decodeCSV(r io.Reader) ([]importRecord, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.Wrap(ErrInvalidImport, "missing header row")
+	}
+	if err != nil {
+		return nil, csvError(err)
+	}
+	// Spreadsheets like to start their exports with a byte order mark.
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	var records []importRecord
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if len(records) == models.MaxImportRows {
+			return nil, errors.Wrapf(ErrInvalidImport, "uploads are limited to %d rows", models.MaxImportRows)
+		}
+		if err != nil {
+			if errors.Is(err, csv.ErrFieldCount) {
+				records = append(records, importRecord{err: errors.Errorf("row has %d columns, the header %d", len(row), len(header))})
+				continue
+			}
+			return nil, csvError(err)
+		}
+
+		values := make(map[string]interface{}, len(header))
+		for i, name := range header {
+			values[name] = row[i]
+		}
+		records = append(records, importRecord{values: values})
+	}
+
+	return records, nil
+}
+
+// csvError tells malformed CSV from failures to read the upload.
+func csvError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return errors.Wrap(ErrInvalidImport, err.Error())
+	}
+	return errors.Wrap(err, "failed to read upload")
+}
+
+// decodeNDJSON reads one JSON object per line. Blank lines are skipped but
+// still counted, so that row numbers match line numbers.
+func decodeNDJSON(r io.Reader) ([]importRecord, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxNDJSONLine)
+
+	var records []importRecord
+	blank := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			blank++
+			continue
+		}
+		for ; blank > 0; blank-- {
+			records = append(records, importRecord{err: errors.New("blank line")})
+		}
+		if len(records) >= models.MaxImportRows {
+			return nil, errors.Wrapf(ErrInvalidImport, "uploads are limited to %d rows", models.MaxImportRows)
+		}
+
+		var values map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &values); err != nil {
+			records = append(records, importRecord{err: errors.Wrap(err, "invalid JSON")})
+			continue
+		}
+		records = append(records, importRecord{values: values})
+	}
+	if err := scanner.Err(); err == bufio.ErrTooLong {
+		return nil, errors.Wrapf(ErrInvalidImport, "lines are limited to %d bytes", maxNDJSONLine)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read upload")
+	}
+
+	return records, nil
+}
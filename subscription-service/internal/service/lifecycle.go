@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"subscription-service/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// transitions lists the statuses each status may move to. Cancelled and
+// expired subscriptions are final.
+var transitions = map[models.SubscriptionStatus][]models.SubscriptionStatus{
+	models.StatusTrial:  {models.StatusActive, models.StatusPaused, models.StatusCancelled, models.StatusExpired},
+	models.StatusActive: {models.StatusPaused, models.StatusCancelled, models.StatusExpired},
+	models.StatusPaused: {models.StatusActive, models.StatusCancelled, models.StatusExpired},
+}
+
+// transitionActions names the transitions to each status in the audit log.
+var transitionActions = map[models.SubscriptionStatus]models.AuditAction{
+	models.StatusPaused:    models.AuditPause,
+	models.StatusActive:    models.AuditResume,
+	models.StatusCancelled: models.AuditCancel,
+}
+
+// isFinal reports whether a subscription in status can no longer change it.
+func isFinal(status models.SubscriptionStatus) bool {
+	return len(transitions[status]) == 0
+}
+
+func canTransition(from, to models.SubscriptionStatus) bool {
+	for _, status := range transitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// effectiveStatus reports a subscription whose end date has passed as
+// expired. Expiry is never written back; it follows from the end date.
+func effectiveStatus(sub *models.Subscription, now time.Time) models.SubscriptionStatus {
+	if sub.EndDate != nil && sub.EndDate.Before(startOfMonth(now)) && canTransition(sub.Status, models.StatusExpired) {
+		return models.StatusExpired
+	}
+	return sub.Status
+}
+
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// PauseSubscription stops billing from the current month on until the
+// subscription is resumed.
+func (s *subscriptionService) PauseSubscription(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
+	return s.transition(ctx, id, models.StatusPaused, func(ctx context.Context, sub *models.Subscription, month time.Time) error {
+		return s.repo.StartPause(ctx, id, month)
+	})
+}
+
+// ResumeSubscription bills the subscription again from the current month on.
+// A trial subscription is activated the same way.
+func (s *subscriptionService) ResumeSubscription(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
+	return s.transition(ctx, id, models.StatusActive, func(ctx context.Context, sub *models.Subscription, month time.Time) error {
+		if sub.Status != models.StatusPaused {
+			return nil
+		}
+		return s.repo.EndPause(ctx, id, month.AddDate(0, -1, 0))
+	})
+}
+
+// CancelSubscription ends the subscription with the current month unless it
+// already ends earlier.
+func (s *subscriptionService) CancelSubscription(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
+	return s.transition(ctx, id, models.StatusCancelled, func(ctx context.Context, sub *models.Subscription, month time.Time) error {
+		if sub.Status != models.StatusPaused {
+			return nil
+		}
+		return s.repo.EndPause(ctx, id, month)
+	})
+}
+
+func (s *subscriptionService) transition(ctx context.Context, id uuid.UUID, to models.SubscriptionStatus, apply func(ctx context.Context, sub *models.Subscription, month time.Time) error) (*models.Subscription, error) {
+	now := time.Now()
+	month := startOfMonth(now)
+
+	var after *models.Subscription
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		sub, err := s.repo.GetByID(ctx, id, false)
+		if err != nil {
+			return errors.Wrap(err, "failed to get subscription from repository")
+		}
+		if sub == nil {
+			return ErrSubscriptionNotFound
+		}
+		if err := authorizeSubscription(ctx, sub); err != nil {
+			return err
+		}
+
+		if current := effectiveStatus(sub, now); !canTransition(current, to) {
+			return errors.Wrapf(ErrInvalidTransition, "cannot move a %s subscription to %s", current, to)
+		}
+
+		var endDate *time.Time
+		if to == models.StatusCancelled && (sub.EndDate == nil || sub.EndDate.After(month)) {
+			endDate = &month
+		}
+
+		updated, err := s.repo.UpdateStatus(ctx, id, sub.Status, to, endDate)
+		if err != nil {
+			return err
+		}
+		if !updated {
+			return errors.Wrap(ErrInvalidTransition, "subscription status changed concurrently")
+		}
+
+		if err := apply(ctx, sub, month); err != nil {
+			return err
+		}
+
+		before := *sub
+		present(&before, now)
+		if after, err = s.GetSubscription(ctx, id, false); err != nil {
+			return err
+		}
+		return s.recordChange(ctx, transitionActions[to], id, &before, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return after, nil
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// outboxClaimLimit is the number of events dispatched at once.
+const outboxClaimLimit = 100
+
+// outboxLease is how long claimed events are left to a dispatcher. It has
+// to outlast the dispatch of a batch to the slowest sink.
+const outboxLease = 5 * time.Minute
+
+// Failed dispatches are retried after outboxRetryBase, doubling up to
+// outboxRetryMax. Events are never given up on.
+const (
+	outboxRetryBase = time.Second
+	outboxRetryMax  = 5 * time.Minute
+)
+
+// outboxTailLimit is the number of events a tail reads at once.
+const outboxTailLimit = 500
+
+// outboxTailLag is how far behind the latest event a tail reads the outbox
+// again. Events carry the time of their change but only show up once its
+// transaction commits, possibly after later events; those showing up more
+// than outboxTailLag late are missed.
+const outboxTailLag = time.Minute
+
+// Sink receives the events dispatched from the outbox. Events are sent at
+// least once, so sinks have to tolerate duplicates; Event.ID tells them
+// apart. An error makes the dispatcher send the event to every sink again
+// later.
+type Sink interface {
+	Send(ctx context.Context, event *models.OutboxEvent) error
+}
+
+type OutboxDispatcher interface {
+	DispatchDue(ctx context.Context) (int, error)
+	PurgeSent(ctx context.Context, retention time.Duration) (int, error)
+}
+
+type outboxDispatcher struct {
+	repo  repository.OutboxRepository
+	sinks []Sink
+}
+
+// NewOutboxDispatcher creates the dispatcher of the events in the outbox,
+// which sends every event to all sinks.
+func NewOutboxDispatcher(repo repository.OutboxRepository, sinks []Sink) OutboxDispatcher {
+	return &outboxDispatcher{repo: repo, sinks: sinks}
+}
+
+// DispatchDue sends the events that are due to the sinks, in the order they
+// were appended, and marks those all sinks received as sent. It returns the
+// number of events it tried to send. Failures are recorded with the events
+// rather than returned.
+func (d *outboxDispatcher) DispatchDue(ctx context.Context) (int, error) {
+	events, err := d.repo.ClaimDue(ctx, outboxLease, outboxClaimLimit)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, event := range events {
+		if err := d.send(ctx, event); err != nil {
+			next := time.Now().Add(outboxBackoff(event.Attempts + 1))
+			if err := d.repo.RecordFailure(ctx, event.ID, next, err.Error()); err != nil {
+				return len(events), err
+			}
+			continue
+		}
+
+		if err := d.repo.MarkSent(ctx, event.ID); err != nil {
+			return len(events), err
+		}
+	}
+
+	return len(events), nil
+}
+
+// send sends an event to every sink, including those after a failing one,
+// and reports the failures together.
+func (d *outboxDispatcher) send(ctx context.Context, event *models.OutboxEvent) error {
+	var failures []string
+	for _, sink := range d.sinks {
+		if err := sink.Send(ctx, event); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// PurgeSent deletes the events sent longer than retention ago.
+func (d *outboxDispatcher) PurgeSent(ctx context.Context, retention time.Duration) (int, error) {
+	return d.repo.DeleteSent(ctx, time.Now().Add(-retention))
+}
+
+// outboxBackoff returns the wait before the dispatch following the given
+// number of failed ones.
+func outboxBackoff(failures int) time.Duration {
+	wait := outboxRetryBase
+	for i := 1; i < failures && wait < outboxRetryMax; i++ {
+		wait *= 2
+	}
+	if wait > outboxRetryMax {
+		wait = outboxRetryMax
+	}
+	return wait
+}
+
+// OutboxTail follows the events appended to the outbox, of all tenants, and
+// hands each of them to a sink once, whether they were dispatched yet or
+// not. Unlike the dispatchers, which share the events among the instances
+// of the service, every tail sees every event.
+type OutboxTail interface {
+	Poll(ctx context.Context) (int, error)
+}
+
+type outboxTail struct {
+	repo    repository.OutboxRepository
+	sink    Sink
+	backlog int
+	started bool
+	// latest is the time of the latest event handed over, or of the start
+	// of the tail. seen holds the times of the events handed over that are
+	// read again.
+	latest time.Time
+	seen   map[uuid.UUID]time.Time
+}
+
+// NewOutboxTail creates a tail of the outbox that hands its events to sink,
+// starting with the last backlog events appended.
+func NewOutboxTail(repo repository.OutboxRepository, sink Sink, backlog int) OutboxTail {
+	return &outboxTail{
+		repo:    repo,
+		sink:    sink,
+		backlog: backlog,
+		latest:  time.Now(),
+		seen:    make(map[uuid.UUID]time.Time),
+	}
+}
+
+// Poll hands the events appended since the previous poll to the sink and
+// returns their number. Events the sink fails to take are handed over again
+// by the following polls while they are read again. Polls must not overlap.
+func (t *outboxTail) Poll(ctx context.Context) (int, error) {
+	handed := 0
+	if !t.started && t.backlog > 0 {
+		events, err := t.repo.ListLatest(ctx, t.backlog)
+		if err != nil {
+			return 0, err
+		}
+		if handed, err = t.hand(ctx, events); err != nil {
+			return handed, err
+		}
+	}
+	t.started = true
+
+	after, afterID := t.latest.Add(-outboxTailLag), uuid.Nil
+	for {
+		events, err := t.repo.ListAppended(ctx, after, afterID, outboxTailLimit)
+		if err != nil {
+			return handed, err
+		}
+		n, err := t.hand(ctx, events)
+		handed += n
+		if err != nil || len(events) < outboxTailLimit {
+			t.forget()
+			return handed, err
+		}
+		last := events[len(events)-1]
+		after, afterID = last.CreatedAt, last.ID
+	}
+}
+
+// hand sends the events not handed over yet to the sink, in order, and
+// returns their number.
+func (t *outboxTail) hand(ctx context.Context, events []*models.OutboxEvent) (int, error) {
+	handed := 0
+	for _, event := range events {
+		if _, ok := t.seen[event.ID]; ok {
+			continue
+		}
+		if err := t.sink.Send(ctx, event); err != nil {
+			return handed, err
+		}
+		handed++
+		t.seen[event.ID] = event.CreatedAt
+		if event.CreatedAt.After(t.latest) {
+			t.latest = event.CreatedAt
+		}
+	}
+	return handed, nil
+}
+
+// forget drops the events that are no longer read again.
+func (t *outboxTail) forget() {
+	horizon := t.latest.Add(-outboxTailLag)
+	for id, createdAt := range t.seen {
+		if createdAt.Before(horizon) {
+			delete(t.seen, id)
+		}
+	}
+}
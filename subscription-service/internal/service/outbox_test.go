@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeOutboxRepository lists the events it holds like the outbox table.
+// Events only show up once they are committed.
+type fakeOutboxRepository struct {
+	repository.OutboxRepository
+
+	events []*models.OutboxEvent
+}
+
+func (r *fakeOutboxRepository) commit(event *models.OutboxEvent) {
+	r.events = append(r.events, event)
+	sort.Slice(r.events, func(i, j int) bool {
+		if !r.events[i].CreatedAt.Equal(r.events[j].CreatedAt) {
+			return r.events[i].CreatedAt.Before(r.events[j].CreatedAt)
+		}
+		return r.events[i].ID.String() < r.events[j].ID.String()
+	})
+}
+
+func (r *fakeOutboxRepository) ListAppended(_ context.Context, after time.Time, afterID uuid.UUID, limit int) ([]*models.OutboxEvent, error) {
+	var events []*models.OutboxEvent
+	for _, event := range r.events {
+		if event.CreatedAt.After(after) || event.CreatedAt.Equal(after) && event.ID.String() > afterID.String() {
+			events = append(events, event)
+		}
+		if len(events) == limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+func (r *fakeOutboxRepository) ListLatest(_ context.Context, limit int) ([]*models.OutboxEvent, error) {
+	if len(r.events) > limit {
+		return r.events[len(r.events)-limit:], nil
+	}
+	return r.events, nil
+}
+
+type recordingSink struct {
+	events []uuid.UUID
+}
+
+func (s *recordingSink) Send(_ context.Context, event *models.OutboxEvent) error {
+	s.events = append(s.events, event.ID)
+	return nil
+}
+
+func newOutboxEvent(createdAt time.Time) *models.OutboxEvent {
+	return &models.OutboxEvent{
+		Event:    models.Event{ID: uuid.New(), Type: models.EventSubscriptionUpdated, CreatedAt: createdAt},
+		TenantID: "tenant",
+	}
+}
+
+func TestOutboxTail(t *testing.T) {
+	now := time.Now()
+	repo := &fakeOutboxRepository{}
+	old := newOutboxEvent(now.Add(-time.Hour))
+	repo.commit(old)
+
+	// Tails of two instances, one of which starts with a backlog.
+	first, second := &recordingSink{}, &recordingSink{}
+	tails := []OutboxTail{NewOutboxTail(repo, first, 10), NewOutboxTail(repo, second, 0)}
+
+	// late is appended before early but commits after it was read.
+	late, early := newOutboxEvent(now.Add(time.Second)), newOutboxEvent(now.Add(2*time.Second))
+	repo.commit(early)
+	poll(t, tails)
+	repo.commit(late)
+	poll(t, tails)
+	// Nothing is handed over twice.
+	poll(t, tails)
+
+	want := map[*recordingSink][]uuid.UUID{
+		first:  {old.ID, early.ID, late.ID},
+		second: {early.ID, late.ID},
+	}
+	for sink, ids := range want {
+		if len(sink.events) != len(ids) {
+			t.Fatalf("sink received %v, want %v", sink.events, ids)
+		}
+		for i, id := range ids {
+			if sink.events[i] != id {
+				t.Errorf("sink received %v, want %v", sink.events, ids)
+				break
+			}
+		}
+	}
+}
+
+func poll(t *testing.T, tails []OutboxTail) {
+	t.Helper()
+
+	for _, tail := range tails {
+		if _, err := tail.Poll(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"subscription-service/internal/models"
+	"subscription-service/internal/tenant"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Headers of the requests of the HTTP sink.
+const (
+	EventIDHeader   = "X-Event-ID"
+	EventTypeHeader = "X-Event-Type"
+)
+
+type logSink struct{}
+
+// NewLogSink returns a sink that logs a line per event.
+func NewLogSink() Sink {
+	return logSink{}
+}
+
+func (logSink) Send(ctx context.Context, event *models.OutboxEvent) error {
+	subscription := "-"
+	if event.Data.Subscription != nil {
+		subscription = event.Data.Subscription.ID.String()
+	}
+	log.Printf("Event %s %s of subscription %s in tenant %s", event.ID, event.Type, subscription, event.TenantID)
+	return nil
+}
+
+type fileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink returns a sink that appends events to the file at path as
+// NDJSON, creating it if necessary. Every event is synced to disk before it
+// counts as sent.
+func NewFileSink(path string) (Sink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open event file")
+	}
+	return &fileSink{file: file}, nil
+}
+
+func (s *fileSink) Send(ctx context.Context, event *models.OutboxEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode event")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return errors.Wrap(err, "failed to write event file")
+	}
+	return errors.Wrap(s.file.Sync(), "failed to sync event file")
+}
+
+type httpSink struct {
+	client *http.Client
+	url    string
+}
+
+// NewHTTPSink returns a sink that posts every event as JSON to url. Responses
+// with a 2xx status acknowledge the event.
+func NewHTTPSink(client *http.Client, url string) Sink {
+	return &httpSink{client: client, url: url}
+}
+
+func (s *httpSink) Send(ctx context.Context, event *models.OutboxEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode event")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create event request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, event.ID.String())
+	req.Header.Set(EventTypeHeader, string(event.Type))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to post event")
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxWebhookDrain))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("event sink responded with %s", resp.Status)
+	}
+	return nil
+}
+
+type webhookSink struct {
+	webhooks WebhookService
+}
+
+// NewWebhookSink returns a sink that schedules the delivery of events to the
+// webhook endpoints of their tenant. Deliveries are scheduled once per
+// event and endpoint however often an event is sent.
+func NewWebhookSink(webhooks WebhookService) Sink {
+	return &webhookSink{webhooks: webhooks}
+}
+
+func (s *webhookSink) Send(ctx context.Context, event *models.OutboxEvent) error {
+	return s.webhooks.Deliver(tenant.WithID(ctx, event.TenantID), &event.Event)
+}
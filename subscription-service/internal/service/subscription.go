@@ -2,32 +2,107 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"subscription-service/internal/auth"
 	"subscription-service/internal/models"
 	"subscription-service/internal/repository"
+	"subscription-service/internal/tenant"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 )
 
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrInvalidCursor        = errors.New("invalid cursor")
+	ErrInvalidSubscription  = errors.New("invalid subscription")
+	ErrPreconditionFailed   = errors.New("precondition failed")
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different request")
+	ErrMissingExchangeRate  = repository.ErrMissingExchangeRate
+)
+
 type SubscriptionService interface {
 	CreateSubscription(ctx context.Context, req *models.CreateSubscriptionRequest) (*models.Subscription, error)
-	GetSubscription(ctx context.Context, id uuid.UUID) (*models.Subscription, error)
-	UpdateSubscription(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionRequest) error
-	DeleteSubscription(ctx context.Context, id uuid.UUID) error
-	ListSubscriptions(ctx context.Context, filter *models.SubscriptionFilter) ([]*models.Subscription, error)
-	GetTotalCost(ctx context.Context, filter *models.SubscriptionFilter) (int, error)
+	CreateSubscriptionOnce(ctx context.Context, key string, req *models.CreateSubscriptionRequest) (*models.Subscription, bool, error)
+	GetSubscription(ctx context.Context, id uuid.UUID, includeDeleted bool) (*models.Subscription, error)
+	UpdateSubscription(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionRequest, ifMatch *int) (*models.Subscription, error)
+	DeleteSubscription(ctx context.Context, id uuid.UUID, ifMatch *int) error
+	ExecuteBatch(ctx context.Context, req *models.BatchRequest) (*models.BatchResponse, error)
+	ImportSubscriptions(ctx context.Context, r io.Reader, opts *models.ImportOptions) (*models.ImportReport, error)
+	RestoreSubscription(ctx context.Context, id uuid.UUID) (*models.Subscription, error)
+	PurgeDeleted(ctx context.Context, retention time.Duration) (int, error)
+	PurgeExpiredKeys(ctx context.Context) (int, error)
+	ListSubscriptions(ctx context.Context, filter *models.SubscriptionFilter, page *models.PageRequest) (*models.SubscriptionPage, error)
+	ExportSubscriptions(ctx context.Context, filter *models.SubscriptionFilter, sort, order string, fn func(*models.Subscription) error) error
+	GetTotalCost(ctx context.Context, filter *models.SubscriptionFilter, currency string) (*models.TotalCostResponse, error)
+	GetCostBreakdown(ctx context.Context, filter *models.SubscriptionFilter, currency string) (*models.CostBreakdownResponse, error)
+	GetCostByService(ctx context.Context, filter *models.SubscriptionFilter, currency string) (*models.ServiceCostResponse, error)
+	PauseSubscription(ctx context.Context, id uuid.UUID) (*models.Subscription, error)
+	ResumeSubscription(ctx context.Context, id uuid.UUID) (*models.Subscription, error)
+	CancelSubscription(ctx context.Context, id uuid.UUID) (*models.Subscription, error)
+	GetPriceHistory(ctx context.Context, id uuid.UUID) ([]*models.PriceChange, error)
 }
 
 type subscriptionService struct {
-	repo repository.SubscriptionRepository
+	repo            repository.SubscriptionRepository
+	services        repository.ServiceRepository
+	users           repository.UserRepository
+	audit           repository.AuditRepository
+	keys            repository.IdempotencyRepository
+	outbox          repository.OutboxRepository
+	tx              repository.Transactor
+	defaultCurrency string
+	keyWindow       time.Duration
 }
 
-func NewSubscriptionService(repo repository.SubscriptionRepository) SubscriptionService {
-	return &subscriptionService{repo: repo}
+// NewSubscriptionService creates the subscription service. Service names
+// are resolved against the catalog in services and subscriptions can only be
+// created for existing users. Every change is recorded in audit and its
+// event appended to outbox. Subscriptions created without a currency and
+// costs requested without one use defaultCurrency. Idempotency keys are kept
+// in keys for keyWindow.
+func NewSubscriptionService(repo repository.SubscriptionRepository, services repository.ServiceRepository, users repository.UserRepository, audit repository.AuditRepository, keys repository.IdempotencyRepository, outbox repository.OutboxRepository, tx repository.Transactor, defaultCurrency string, keyWindow time.Duration) SubscriptionService {
+	return &subscriptionService{
+		repo:            repo,
+		services:        services,
+		users:           users,
+		audit:           audit,
+		keys:            keys,
+		outbox:          outbox,
+		tx:              tx,
+		defaultCurrency: defaultCurrency,
+		keyWindow:       keyWindow,
+	}
 }
 
 func (s *subscriptionService) CreateSubscription(ctx context.Context, req *models.CreateSubscriptionRequest) (*models.Subscription, error) {
+	subscription, err := s.prepareSubscription(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		return s.insertSubscription(ctx, subscription)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+// prepareSubscription turns req into a new subscription without storing it:
+// it parses the dates, checks the user, resolves the service name against
+// the catalog and applies its defaults, and validates the billing settings.
+func (s *subscriptionService) prepareSubscription(ctx context.Context, req *models.CreateSubscriptionRequest) (*models.Subscription, error) {
+	if err := authorizeUser(ctx, req.UserID); err != nil {
+		return nil, err
+	}
+
 	startDate, err := time.Parse("01-2006", req.StartDate)
 	if err != nil {
 		return nil, errors.Wrap(err, "invalid start date format")
@@ -42,55 +117,570 @@ func (s *subscriptionService) CreateSubscription(ctx context.Context, req *model
 		endDate = &parsedEndDate
 	}
 
+	status := models.StatusActive
+	if req.Status != "" {
+		status = models.SubscriptionStatus(req.Status)
+	}
+
+	user, err := s.users.GetByID(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.Wrapf(ErrInvalidSubscription, "user %s does not exist", req.UserID)
+	}
+
+	svc, err := s.services.Resolve(ctx, req.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName, price, currency := req.ServiceName, req.Price, req.Currency
+	var serviceID *uuid.UUID
+	if svc != nil {
+		serviceID, serviceName = &svc.ID, svc.Name
+		if price == 0 && svc.DefaultPrice != nil {
+			price = *svc.DefaultPrice
+			if currency == "" && svc.Currency != nil {
+				currency = *svc.Currency
+			}
+		}
+	}
+	if price == 0 {
+		return nil, errors.Wrap(ErrInvalidSubscription, "price is required unless the service has a default price")
+	}
+	if currency == "" {
+		currency = s.defaultCurrency
+	}
+
 	subscription := &models.Subscription{
 		ID:          uuid.New(),
-		ServiceName: req.ServiceName,
-		Price:       req.Price,
+		ServiceName: serviceName,
+		ServiceID:   serviceID,
+		Price:       price,
+		Currency:    currency,
 		UserID:      req.UserID,
 		StartDate:   startDate,
 		EndDate:     endDate,
+		Status:      status,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
 
-	if err := s.repo.Create(ctx, subscription); err != nil {
-		return nil, errors.Wrap(err, "failed to create subscription in repository")
+	err = applyBilling(subscription, models.BillingPeriod(req.BillingPeriod), req.BillingInterval, req.BillingAnchorDay)
+	if err != nil {
+		return nil, err
 	}
 
 	return subscription, nil
 }
 
-func (s *subscriptionService) GetSubscription(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
-	subscription, err := s.repo.GetByID(ctx, id)
+// insertSubscription stores a prepared subscription with its initial price.
+// It has to be called within a transaction.
+func (s *subscriptionService) insertSubscription(ctx context.Context, subscription *models.Subscription) error {
+	if err := s.repo.Create(ctx, subscription); err != nil {
+		return errors.Wrap(err, "failed to create subscription in repository")
+	}
+	if err := s.repo.AddPriceChange(ctx, subscription.ID, subscription.Price, subscription.Currency, subscription.StartDate); err != nil {
+		return err
+	}
+
+	present(subscription, time.Now())
+	return s.recordChange(ctx, models.AuditCreate, subscription.ID, nil, subscription)
+}
+
+// CreateSubscriptionOnce creates a subscription like CreateSubscription
+// unless the caller already created one with the same idempotency key, in
+// which case that subscription is returned as it was created and the result
+// reports the replay. Reusing a key for a different request fails with
+// ErrIdempotencyKeyReused. Failed creations do not use up the key.
+func (s *subscriptionService) CreateSubscriptionOnce(ctx context.Context, key string, req *models.CreateSubscriptionRequest) (*models.Subscription, bool, error) {
+	hash, err := hashRequest(req)
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := time.Now()
+	reserved := &models.IdempotencyKey{
+		Key:         key,
+		Actor:       auth.Actor(ctx),
+		RequestHash: hash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.keyWindow),
+	}
+
+	var subscription *models.Subscription
+	var replayed bool
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		stored, err := s.keys.Reserve(ctx, reserved)
+		if err != nil {
+			return err
+		}
+		if stored != nil {
+			if stored.RequestHash != hash {
+				return ErrIdempotencyKeyReused
+			}
+			replayed = true
+			return errors.Wrap(json.Unmarshal(stored.Response, &subscription), "failed to decode stored response")
+		}
+
+		if subscription, err = s.CreateSubscription(ctx, req); err != nil {
+			return err
+		}
+		if reserved.Response, err = json.Marshal(subscription); err != nil {
+			return errors.Wrap(err, "failed to encode response")
+		}
+		return s.keys.Complete(ctx, reserved)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return subscription, replayed, nil
+}
+
+// hashRequest identifies a request by the SHA-256 hash of its canonical JSON
+// encoding, which does not depend on the formatting of the request body.
+func hashRequest(req interface{}) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode request")
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// GetSubscription hides deleted subscriptions unless includeDeleted is set,
+// which only admins may do.
+func (s *subscriptionService) GetSubscription(ctx context.Context, id uuid.UUID, includeDeleted bool) (*models.Subscription, error) {
+	if includeDeleted {
+		if err := authorizeIncludeDeleted(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	subscription, err := s.repo.GetByID(ctx, id, includeDeleted)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get subscription from repository")
 	}
 	if subscription == nil {
-		return nil, errors.New("subscription not found")
+		return nil, ErrSubscriptionNotFound
 	}
+	if err := authorizeSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+	present(subscription, time.Now())
 	return subscription, nil
 }
 
-func (s *subscriptionService) UpdateSubscription(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionRequest) error {
-	if _, err := s.GetSubscription(ctx, id); err != nil {
+// UpdateSubscription applies req and returns the updated subscription. When
+// ifMatch is given, the subscription is only updated while it is still at
+// that version. Either way the update fails with ErrPreconditionFailed when
+// the subscription changes concurrently. The end date and billing of
+// cancelled and expired subscriptions cannot be changed, as that would bill
+// them again; such updates fail with ErrInvalidTransition.
+func (s *subscriptionService) UpdateSubscription(ctx context.Context, id uuid.UUID, req *models.UpdateSubscriptionRequest, ifMatch *int) (*models.Subscription, error) {
+	effectiveFrom := startOfMonth(time.Now())
+	if req.PriceEffectiveFrom != nil {
+		month, err := time.Parse("01-2006", *req.PriceEffectiveFrom)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid price effective from format")
+		}
+		effectiveFrom = month
+	}
+
+	var after *models.Subscription
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		subscription, err := s.GetSubscription(ctx, id, false)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(subscription, ifMatch); err != nil {
+			return err
+		}
+		if isFinal(subscription.Status) && (req.EndDate != nil || req.BillingPeriod != nil || req.BillingInterval != nil || req.BillingAnchorDay != nil) {
+			return errors.Wrapf(ErrInvalidTransition, "cannot change the end date or billing of a %s subscription", subscription.Status)
+		}
+		before := *subscription
+
+		// Recorded prices keep their currency, so a new currency needs a
+		// new price to apply from the effective month on.
+		currency := subscription.Currency
+		if req.Currency != nil && *req.Currency != currency {
+			if req.Price == nil {
+				return errors.Wrap(ErrInvalidSubscription, "changing the currency requires a new price")
+			}
+			currency = *req.Currency
+		}
+
+		if req.BillingPeriod != nil || req.BillingInterval != nil || req.BillingAnchorDay != nil {
+			if err := mergeBilling(subscription, req); err != nil {
+				return err
+			}
+		}
+
+		// A new service name is resolved against the catalog like on
+		// creation; names the catalog does not know unlink the subscription.
+		var serviceID *uuid.UUID
+		if req.ServiceName != nil {
+			svc, err := s.services.Resolve(ctx, *req.ServiceName)
+			if err != nil {
+				return err
+			}
+			if svc != nil {
+				serviceID = &svc.ID
+				req.ServiceName = &svc.Name
+			}
+		}
+
+		// The price of the subscription itself only changes once the new
+		// price is in effect; until then it is only in the price history.
+		update := req
+		if req.Price != nil && effectiveFrom.After(startOfMonth(time.Now())) {
+			deferred := *req
+			deferred.Price, deferred.Currency = nil, nil
+			update = &deferred
+		}
+
+		updated, err := s.repo.Update(ctx, id, subscription.Version, update)
+		if err != nil {
+			return err
+		}
+		if !updated {
+			return errors.Wrap(ErrPreconditionFailed, "subscription changed concurrently")
+		}
+
+		if req.ServiceName != nil {
+			if err := s.repo.LinkService(ctx, id, serviceID); err != nil {
+				return err
+			}
+		}
+
+		if req.Price != nil {
+			if err := s.repo.AddPriceChange(ctx, id, *req.Price, currency, effectiveFrom); err != nil {
+				return err
+			}
+		}
+
+		if after, err = s.GetSubscription(ctx, id, false); err != nil {
+			return err
+		}
+		return s.recordChange(ctx, models.AuditUpdate, id, &before, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return after, nil
+}
+
+// DeleteSubscription deletes a subscription, when ifMatch is given only
+// while it is still at that version.
+func (s *subscriptionService) DeleteSubscription(ctx context.Context, id uuid.UUID, ifMatch *int) error {
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		subscription, err := s.GetSubscription(ctx, id, false)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(subscription, ifMatch); err != nil {
+			return err
+		}
+
+		deleted, err := s.repo.Delete(ctx, id, subscription.Version)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return errors.Wrap(ErrPreconditionFailed, "subscription changed concurrently")
+		}
+		return s.recordChange(ctx, models.AuditDelete, id, subscription, nil)
+	})
+}
+
+// checkVersion fails with ErrPreconditionFailed unless sub is at version
+// ifMatch. A nil ifMatch matches any version.
+func checkVersion(sub *models.Subscription, ifMatch *int) error {
+	if ifMatch != nil && *ifMatch != sub.Version {
+		return errors.Wrapf(ErrPreconditionFailed, "subscription is at version %d", sub.Version)
+	}
+	return nil
+}
+
+// RestoreSubscription undoes the deletion of a subscription that has not
+// been purged yet. Restoring a subscription that is not deleted changes
+// nothing.
+func (s *subscriptionService) RestoreSubscription(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
+	var after *models.Subscription
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		before, err := s.repo.GetByID(ctx, id, true)
+		if err != nil {
+			return errors.Wrap(err, "failed to get subscription from repository")
+		}
+		if before == nil {
+			return ErrSubscriptionNotFound
+		}
+		if err := authorizeSubscription(ctx, before); err != nil {
+			return err
+		}
+		if before.DeletedAt == nil {
+			after = before
+			present(after, time.Now())
+			return nil
+		}
+
+		// Subscriptions of deleted users stay deleted, as restoring them
+		// would attach them to a user that no longer exists.
+		user, err := s.users.GetByID(ctx, before.UserID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return errors.Wrapf(ErrInvalidTransition, "user %s was deleted", before.UserID)
+		}
+
+		if err := s.repo.Restore(ctx, id); err != nil {
+			return err
+		}
+
+		present(before, time.Now())
+		if after, err = s.GetSubscription(ctx, id, false); err != nil {
+			return err
+		}
+		return s.recordChange(ctx, models.AuditRestore, id, before, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return after, nil
+}
+
+// PurgeDeleted permanently removes the subscriptions of all tenants that
+// were deleted longer than retention ago, and the deleted users left without
+// subscriptions, and returns how many subscriptions it removed.
+func (s *subscriptionService) PurgeDeleted(ctx context.Context, retention time.Duration) (int, error) {
+	var count int
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		purged, err := s.repo.PurgeDeleted(ctx, time.Now().Add(-retention))
+		if err != nil {
+			return err
+		}
+
+		for tenantID, ids := range purged {
+			ctx := tenant.WithID(ctx, tenantID)
+			for _, id := range ids {
+				if err := recordChange(ctx, s.audit, models.AuditPurge, id, nil, nil); err != nil {
+					return err
+				}
+			}
+			count += len(ids)
+		}
+
+		// Deleted users are kept only as long as subscriptions reference
+		// them.
+		_, err = s.users.PurgeDeleted(ctx)
 		return err
+	})
+
+	return count, err
+}
+
+// PurgeExpiredKeys deletes the expired idempotency keys of all tenants and
+// returns their number.
+func (s *subscriptionService) PurgeExpiredKeys(ctx context.Context) (int, error) {
+	return s.keys.DeleteExpired(ctx, time.Now())
+}
+
+func (s *subscriptionService) ListSubscriptions(ctx context.Context, filter *models.SubscriptionFilter, page *models.PageRequest) (*models.SubscriptionPage, error) {
+	if err := scopeFilter(ctx, filter); err != nil {
+		return nil, err
+	}
+
+	opts := &models.ListOptions{
+		Limit: page.Limit + 1,
+		Sort:  page.Sort,
+		Order: page.Order,
+	}
+
+	if page.Cursor != "" {
+		cursor, err := decodeCursor(page.Cursor)
+		if err != nil || cursor.Sort != page.Sort || cursor.Order != page.Order {
+			return nil, ErrInvalidCursor
+		}
+		opts.After = cursor
+	}
+
+	subscriptions, err := s.repo.List(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, sub := range subscriptions {
+		present(sub, now)
+	}
+
+	total, err := s.repo.Count(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.SubscriptionPage{
+		Subscriptions: subscriptions,
+		Total:         total,
+	}
+
+	// One extra row is fetched to find out whether another page follows.
+	if len(subscriptions) > page.Limit {
+		result.Subscriptions = subscriptions[:page.Limit]
+		last := result.Subscriptions[page.Limit-1]
+		result.NextCursor = encodeCursor(&models.PageCursor{
+			Sort:  page.Sort,
+			Order: page.Order,
+			Value: cursorValue(last, page.Sort),
+			ID:    last.ID,
+		})
+	}
+
+	if result.Subscriptions == nil {
+		result.Subscriptions = []*models.Subscription{}
 	}
 
-	return s.repo.Update(ctx, id, req)
+	return result, nil
 }
 
-func (s *subscriptionService) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
-	if _, err := s.GetSubscription(ctx, id); err != nil {
+// ExportSubscriptions passes every subscription ListSubscriptions would list
+// to fn as it is read from the database, without paging.
+func (s *subscriptionService) ExportSubscriptions(ctx context.Context, filter *models.SubscriptionFilter, sort, order string, fn func(*models.Subscription) error) error {
+	if err := scopeFilter(ctx, filter); err != nil {
 		return err
 	}
 
-	return s.repo.Delete(ctx, id)
+	now := time.Now()
+	return s.repo.Each(ctx, filter, &models.ListOptions{Sort: sort, Order: order}, func(sub *models.Subscription) error {
+		present(sub, now)
+		return fn(sub)
+	})
+}
+
+func (s *subscriptionService) GetTotalCost(ctx context.Context, filter *models.SubscriptionFilter, currency string) (*models.TotalCostResponse, error) {
+	if err := scopeFilter(ctx, filter); err != nil {
+		return nil, err
+	}
+
+	if currency == "" {
+		currency = s.defaultCurrency
+	}
+
+	totalCost, err := s.repo.GetTotalCost(ctx, filter, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TotalCostResponse{TotalCost: totalCost, Currency: currency}, nil
+}
+
+func (s *subscriptionService) GetCostBreakdown(ctx context.Context, filter *models.SubscriptionFilter, currency string) (*models.CostBreakdownResponse, error) {
+	if err := scopeFilter(ctx, filter); err != nil {
+		return nil, err
+	}
+
+	if currency == "" {
+		currency = s.defaultCurrency
+	}
+
+	lines, err := s.repo.GetCostBreakdown(ctx, filter, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.CostBreakdownResponse{Lines: lines, Currency: currency}
+	if response.Lines == nil {
+		response.Lines = []*models.CostBreakdownLine{}
+	}
+	for _, line := range lines {
+		response.TotalCost += line.Amount
+	}
+
+	return response, nil
+}
+
+func (s *subscriptionService) GetCostByService(ctx context.Context, filter *models.SubscriptionFilter, currency string) (*models.ServiceCostResponse, error) {
+	if err := scopeFilter(ctx, filter); err != nil {
+		return nil, err
+	}
+
+	if currency == "" {
+		currency = s.defaultCurrency
+	}
+
+	costs, err := s.repo.GetCostByService(ctx, filter, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.ServiceCostResponse{Services: costs, Currency: currency}
+	if response.Services == nil {
+		response.Services = []*models.ServiceCost{}
+	}
+	for _, cost := range costs {
+		response.TotalCost += cost.Amount
+	}
+
+	return response, nil
 }
 
-func (s *subscriptionService) ListSubscriptions(ctx context.Context, filter *models.SubscriptionFilter) ([]*models.Subscription, error) {
-	return s.repo.List(ctx, filter)
+func (s *subscriptionService) GetPriceHistory(ctx context.Context, id uuid.UUID) ([]*models.PriceChange, error) {
+	if _, err := s.GetSubscription(ctx, id, false); err != nil {
+		return nil, err
+	}
+
+	history, err := s.repo.ListPriceHistory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if history == nil {
+		history = []*models.PriceChange{}
+	}
+
+	return history, nil
+}
+
+// present fills in the fields of a subscription that are derived rather than
+// stored.
+func present(sub *models.Subscription, now time.Time) {
+	sub.Status = effectiveStatus(sub, now)
+	sub.NextBillingDate = nextBillingDate(sub, now)
 }
 
-func (s *subscriptionService) GetTotalCost(ctx context.Context, filter *models.SubscriptionFilter) (int, error) {
-	return s.repo.GetTotalCost(ctx, filter)
+// mergeBilling validates the billing settings of req combined with the
+// current ones of sub and writes the complete settings back to req. Settings
+// that do not carry over to a different kind of period are reset.
+func mergeBilling(sub *models.Subscription, req *models.UpdateSubscriptionRequest) error {
+	period := sub.BillingPeriod
+	if req.BillingPeriod != nil {
+		period = models.BillingPeriod(*req.BillingPeriod)
+	}
+
+	var interval, anchorDay int
+	if req.BillingInterval != nil {
+		interval = *req.BillingInterval
+	} else if period == models.BillingCustom && sub.BillingPeriod == models.BillingCustom {
+		interval = sub.BillingInterval
+	}
+	if req.BillingAnchorDay != nil {
+		anchorDay = *req.BillingAnchorDay
+	} else if (period == models.BillingWeekly) == (sub.BillingPeriod == models.BillingWeekly) {
+		anchorDay = sub.BillingAnchorDay
+	}
+
+	if err := applyBilling(sub, period, interval, anchorDay); err != nil {
+		return err
+	}
+
+	billingPeriod := string(sub.BillingPeriod)
+	req.BillingPeriod = &billingPeriod
+	req.BillingInterval = &sub.BillingInterval
+	req.BillingAnchorDay = &sub.BillingAnchorDay
+	return nil
 }
@@ -0,0 +1,134 @@
+package service_test
+
+import (
+	"context"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/service"
+	"subscription-service/internal/tenant"
+	"subscription-service/internal/testdb"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// TestCancelledSubscriptionCost checks that cancelled subscriptions are only
+// billed up to the month they were cancelled in, however they are updated
+// afterwards.
+func TestCancelledSubscriptionCost(t *testing.T) {
+	db, _ := testdb.Open(t)
+	ctx := tenant.WithID(context.Background(), tenant.Default)
+
+	users := repository.NewUserRepository(db)
+	subscriptions := service.NewSubscriptionService(repository.NewSubscriptionRepository(db), repository.NewServiceRepository(db), users,
+		repository.NewAuditRepository(db), repository.NewIdempotencyRepository(db), repository.NewOutboxRepository(db),
+		repository.NewTransactor(db), "RUB", time.Hour)
+
+	now := time.Now()
+	user := &models.User{ID: uuid.New(), CreatedAt: now, UpdatedAt: now}
+	if _, err := users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	// Charged on the first of this month and the two before.
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	sub, err := subscriptions.CreateSubscription(ctx, &models.CreateSubscriptionRequest{
+		ServiceName: "Netflix",
+		Price:       100,
+		UserID:      user.ID,
+		StartDate:   thisMonth.AddDate(0, -2, 0).Format("01-2006"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := subscriptions.CancelSubscription(ctx, sub.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	later, empty, yearly := thisMonth.AddDate(1, 0, 0).Format("01-2006"), "", string(models.BillingYearly)
+	updates := map[string]*models.UpdateSubscriptionRequest{
+		"extended end date": {EndDate: &later},
+		"cleared end date":  {EndDate: &empty},
+		"billing period":    {BillingPeriod: &yearly},
+	}
+	for name, req := range updates {
+		if _, err := subscriptions.UpdateSubscription(ctx, sub.ID, req, nil); errors.Cause(err) != service.ErrInvalidTransition {
+			t.Errorf("%s: UpdateSubscription() = %v, want %v", name, err, service.ErrInvalidTransition)
+		}
+	}
+
+	start, end := thisMonth.AddDate(0, -2, 0), thisMonth.AddDate(2, 0, 0)
+	filter := &models.SubscriptionFilter{UserIDs: []uuid.UUID{user.ID}, StartDate: &start, EndDate: &end}
+	cost, err := subscriptions.GetTotalCost(ctx, filter, "RUB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost.TotalCost != 300 {
+		t.Errorf("total cost = %d, want 300", cost.TotalCost)
+	}
+}
+
+// TestScheduledPriceChange checks that a price change taking effect later
+// neither shows before then nor applies to months before the first recorded
+// price.
+func TestScheduledPriceChange(t *testing.T) {
+	db, _ := testdb.Open(t)
+	ctx := tenant.WithID(context.Background(), tenant.Default)
+
+	users := repository.NewUserRepository(db)
+	subscriptions := service.NewSubscriptionService(repository.NewSubscriptionRepository(db), repository.NewServiceRepository(db), users,
+		repository.NewAuditRepository(db), repository.NewIdempotencyRepository(db), repository.NewOutboxRepository(db),
+		repository.NewTransactor(db), "RUB", time.Hour)
+
+	now := time.Now()
+	user := &models.User{ID: uuid.New(), CreatedAt: now, UpdatedAt: now}
+	if _, err := users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	sub, err := subscriptions.CreateSubscription(ctx, &models.CreateSubscriptionRequest{
+		ServiceName: "Netflix",
+		Price:       100,
+		UserID:      user.ID,
+		StartDate:   thisMonth.AddDate(0, -1, 0).Format("01-2006"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	price, nextMonth := 200, thisMonth.AddDate(0, 1, 0).Format("01-2006")
+	updated, err := subscriptions.UpdateSubscription(ctx, sub.ID, &models.UpdateSubscriptionRequest{Price: &price, PriceEffectiveFrom: &nextMonth}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Price != 100 {
+		t.Errorf("price = %d before the change takes effect, want 100", updated.Price)
+	}
+
+	priceMin := 150
+	page, err := subscriptions.ListSubscriptions(ctx, &models.SubscriptionFilter{UserIDs: []uuid.UUID{user.ID}, PriceMin: &priceMin}, &models.PageRequest{Limit: 10, Sort: models.SortByPrice, Order: models.SortAsc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Subscriptions) != 0 {
+		t.Errorf("listed %d subscriptions by a price not in effect yet", len(page.Subscriptions))
+	}
+
+	// The month added before the first recorded price costs that price.
+	start := thisMonth.AddDate(0, -2, 0).Format("01-2006")
+	if _, err := subscriptions.UpdateSubscription(ctx, sub.ID, &models.UpdateSubscriptionRequest{StartDate: &start}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	from, to := thisMonth.AddDate(0, -2, 0), thisMonth.AddDate(0, 1, 0)
+	cost, err := subscriptions.GetTotalCost(ctx, &models.SubscriptionFilter{UserIDs: []uuid.UUID{user.ID}, StartDate: &from, EndDate: &to}, "RUB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost.TotalCost != 500 {
+		t.Errorf("total cost = %d, want 500", cost.TotalCost)
+	}
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrUserNotFound         = errors.New("user not found")
+	ErrUserConflict         = errors.New("user already exists")
+	ErrUserHasSubscriptions = errors.New("user has subscriptions")
+	ErrInvalidReassign      = errors.New("invalid reassignment")
+)
+
+type UserService interface {
+	CreateUser(ctx context.Context, req *models.CreateUserRequest) (*models.User, error)
+	GetUser(ctx context.Context, id uuid.UUID) (*models.User, error)
+	UpdateUser(ctx context.Context, id uuid.UUID, req *models.UpdateUserRequest) (*models.User, error)
+	DeleteUser(ctx context.Context, id uuid.UUID, reassignTo *uuid.UUID) error
+	ListUsers(ctx context.Context) ([]*models.User, error)
+	IssueCalendarToken(ctx context.Context, id uuid.UUID) (string, error)
+	RevokeCalendarToken(ctx context.Context, id uuid.UUID) error
+	GetChargeSchedule(ctx context.Context, id uuid.UUID, token string) (*models.User, []*models.ChargeSeries, error)
+}
+
+type userService struct {
+	repo          repository.UserRepository
+	subscriptions repository.SubscriptionRepository
+	audit         repository.AuditRepository
+	outbox        repository.OutboxRepository
+	tx            repository.Transactor
+	deletePolicy  models.UserDeletePolicy
+	reassignTo    *uuid.UUID
+}
+
+// NewUserService creates the user service. deletePolicy decides what
+// happens to the subscriptions of deleted users; under the reassign policy
+// they are moved to reassignTo unless the request names another user. The
+// subscriptions changed along with users are recorded in the audit log and
+// their events appended to outbox.
+func NewUserService(repo repository.UserRepository, subscriptions repository.SubscriptionRepository, audit repository.AuditRepository, outbox repository.OutboxRepository, tx repository.Transactor, deletePolicy models.UserDeletePolicy, reassignTo *uuid.UUID) UserService {
+	return &userService{
+		repo:          repo,
+		subscriptions: subscriptions,
+		audit:         audit,
+		outbox:        outbox,
+		tx:            tx,
+		deletePolicy:  deletePolicy,
+		reassignTo:    reassignTo,
+	}
+}
+
+func (s *userService) CreateUser(ctx context.Context, req *models.CreateUserRequest) (*models.User, error) {
+	user := &models.User{
+		ID:        uuid.New(),
+		Name:      strings.TrimSpace(req.Name),
+		Email:     req.Email,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if req.ID != nil {
+		user.ID = *req.ID
+	}
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		existing, err := s.repo.GetByID(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return errors.Wrapf(ErrUserConflict, "user %s already exists", user.ID)
+		}
+
+		if err := s.checkEmail(ctx, user.ID, user.Email); err != nil {
+			return err
+		}
+
+		// Ids are unique across tenants, so an id taken in another tenant
+		// conflicts as well.
+		created, err := s.repo.Create(ctx, user)
+		if err != nil {
+			return err
+		}
+		if !created {
+			return errors.Wrapf(ErrUserConflict, "user %s already exists", user.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *userService) GetUser(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get user from repository")
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *userService) UpdateUser(ctx context.Context, id uuid.UUID, req *models.UpdateUserRequest) (*models.User, error) {
+	var user *models.User
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := s.GetUser(ctx, id); err != nil {
+			return err
+		}
+
+		if req.Name != nil {
+			name := strings.TrimSpace(*req.Name)
+			req.Name = &name
+		}
+		if err := s.checkEmail(ctx, id, req.Email); err != nil {
+			return err
+		}
+
+		if err := s.repo.Update(ctx, id, req); err != nil {
+			return err
+		}
+
+		var err error
+		user, err = s.GetUser(ctx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// DeleteUser deletes a user and handles its subscriptions according to the
+// delete policy. reassignTo overrides the configured user subscriptions are
+// reassigned to and may only be given under the reassign policy. The user
+// is kept, marked as deleted, until the purge has removed the deleted
+// subscriptions referencing it.
+func (s *userService) DeleteUser(ctx context.Context, id uuid.UUID, reassignTo *uuid.UUID) error {
+	if reassignTo != nil && s.deletePolicy != models.UserDeleteReassign {
+		return errors.Wrapf(ErrInvalidReassign, "subscriptions are not reassigned under the %s policy", s.deletePolicy)
+	}
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := s.GetUser(ctx, id); err != nil {
+			return err
+		}
+
+		switch s.deletePolicy {
+		case models.UserDeleteCascade:
+			if err := s.deleteSubscriptions(ctx, id); err != nil {
+				return err
+			}
+		case models.UserDeleteReassign:
+			if err := s.reassign(ctx, id, reassignTo); err != nil {
+				return err
+			}
+		default:
+			count, err := s.subscriptions.Count(ctx, &models.SubscriptionFilter{UserIDs: []uuid.UUID{id}})
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return errors.Wrapf(ErrUserHasSubscriptions, "user has %d subscriptions", count)
+			}
+		}
+
+		return s.repo.Delete(ctx, id)
+	})
+}
+
+func (s *userService) ListUsers(ctx context.Context) ([]*models.User, error) {
+	users, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if users == nil {
+		users = []*models.User{}
+	}
+
+	return users, nil
+}
+
+func (s *userService) reassign(ctx context.Context, id uuid.UUID, to *uuid.UUID) error {
+	if to == nil {
+		to = s.reassignTo
+	}
+	if to == nil {
+		return errors.Wrap(ErrInvalidReassign, "reassign_to is required")
+	}
+	if *to == id {
+		return errors.Wrap(ErrInvalidReassign, "cannot reassign subscriptions to the deleted user")
+	}
+
+	target, err := s.repo.GetByID(ctx, *to)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		return errors.Wrapf(ErrInvalidReassign, "user %s does not exist", *to)
+	}
+
+	changes, err := s.subscriptions.ReassignUser(ctx, id, *to)
+	if err != nil {
+		return err
+	}
+	return recordChanges(ctx, s.audit, s.outbox, models.AuditUpdate, changes)
+}
+
+// deleteSubscriptions deletes the subscriptions of a user and records each
+// of them like a deletion of the subscription alone.
+func (s *userService) deleteSubscriptions(ctx context.Context, id uuid.UUID) error {
+	changes, err := s.subscriptions.DeleteByUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	return recordChanges(ctx, s.audit, s.outbox, models.AuditDelete, changes)
+}
+
+// checkEmail makes sure no user other than id has the email.
+func (s *userService) checkEmail(ctx context.Context, id uuid.UUID, email *string) error {
+	if email == nil || *email == "" {
+		return nil
+	}
+
+	other, err := s.repo.GetByEmail(ctx, *email)
+	if err != nil {
+		return err
+	}
+	if other != nil && other.ID != id {
+		return errors.Wrapf(ErrUserConflict, "email %s is already taken", *email)
+	}
+	return nil
+}
@@ -0,0 +1,492 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"subscription-service/internal/tenant"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook endpoint not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrInvalidWebhook   = errors.New("invalid webhook endpoint")
+)
+
+// webhookSecretPrefix starts every generated webhook secret.
+const webhookSecretPrefix = "whsec_"
+
+// Headers of webhook requests. The signature is the hex encoded HMAC-SHA256
+// of the timestamp, a dot and the body, keyed with the endpoint secret, and
+// prefixed with sha256=.
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookIDHeader        = "X-Webhook-ID"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// webhookClaimLimit is the number of deliveries attempted at once.
+const webhookClaimLimit = 20
+
+// maxWebhookDrain caps the part of responses read to reuse connections.
+// Responses are never stored, so endpoints cannot be used to read what the
+// service reaches.
+const maxWebhookDrain = 4096
+
+// nonPublicPrefixes are the address ranges webhooks are not sent to besides
+// the loopback, private, link-local, multicast and unspecified addresses.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // this network
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // reserved and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, which reaches any IPv4 address
+}
+
+// renewalEventNamespace derives the ids of renewal notices, so that every
+// charge is announced only once however often the renewals are scanned.
+var renewalEventNamespace = uuid.MustParse("0b0d7c1e-7a8f-4d4e-9a51-5b6d3f0c2e91")
+
+type WebhookService interface {
+	Deliver(ctx context.Context, event *models.Event) error
+	CreateEndpoint(ctx context.Context, req *models.CreateWebhookEndpointRequest) (*models.CreatedWebhookEndpoint, error)
+	ListEndpoints(ctx context.Context) ([]*models.WebhookEndpoint, error)
+	GetEndpoint(ctx context.Context, id uuid.UUID) (*models.WebhookEndpoint, error)
+	UpdateEndpoint(ctx context.Context, id uuid.UUID, req *models.UpdateWebhookEndpointRequest) (*models.WebhookEndpoint, error)
+	DeleteEndpoint(ctx context.Context, id uuid.UUID) error
+	ListDeliveries(ctx context.Context, endpointID uuid.UUID, limit int) ([]*models.WebhookDelivery, error)
+	Redeliver(ctx context.Context, endpointID, deliveryID uuid.UUID) (*models.WebhookDelivery, error)
+	DeliverDue(ctx context.Context) (int, error)
+	PublishRenewals(ctx context.Context) (int, error)
+}
+
+type webhookService struct {
+	repo          repository.WebhookRepository
+	subscriptions repository.SubscriptionRepository
+	client        *http.Client
+	retry         models.WebhookRetryPolicy
+	renewalNotice time.Duration
+}
+
+// NewWebhookService creates the webhook service. Events are delivered with
+// client, whose timeout bounds every attempt, and retried according to
+// retry; see NewWebhookClient. Charges are announced renewalNotice ahead.
+func NewWebhookService(repo repository.WebhookRepository, subscriptions repository.SubscriptionRepository, client *http.Client, retry models.WebhookRetryPolicy, renewalNotice time.Duration) WebhookService {
+	return &webhookService{
+		repo:          repo,
+		subscriptions: subscriptions,
+		client:        client,
+		retry:         retry,
+		renewalNotice: renewalNotice,
+	}
+}
+
+func (s *webhookService) CreateEndpoint(ctx context.Context, req *models.CreateWebhookEndpointRequest) (*models.CreatedWebhookEndpoint, error) {
+	if err := checkWebhookURL(ctx, req.URL); err != nil {
+		return nil, err
+	}
+
+	secret := ""
+	if req.Secret != nil {
+		secret = *req.Secret
+	} else {
+		token, err := randomToken(24)
+		if err != nil {
+			return nil, err
+		}
+		secret = webhookSecretPrefix + token
+	}
+
+	now := time.Now()
+	endpoint := &models.WebhookEndpoint{
+		ID:         uuid.New(),
+		URL:        req.URL,
+		Secret:     secret,
+		EventTypes: dedupe(req.EventTypes),
+		Active:     true,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := s.repo.CreateEndpoint(ctx, endpoint); err != nil {
+		return nil, err
+	}
+
+	return &models.CreatedWebhookEndpoint{WebhookEndpoint: *endpoint, Secret: secret}, nil
+}
+
+func (s *webhookService) ListEndpoints(ctx context.Context) ([]*models.WebhookEndpoint, error) {
+	endpoints, err := s.repo.ListEndpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if endpoints == nil {
+		endpoints = []*models.WebhookEndpoint{}
+	}
+
+	return endpoints, nil
+}
+
+func (s *webhookService) GetEndpoint(ctx context.Context, id uuid.UUID) (*models.WebhookEndpoint, error) {
+	endpoint, err := s.repo.GetEndpoint(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint == nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	return endpoint, nil
+}
+
+func (s *webhookService) UpdateEndpoint(ctx context.Context, id uuid.UUID, req *models.UpdateWebhookEndpointRequest) (*models.WebhookEndpoint, error) {
+	endpoint, err := s.GetEndpoint(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.URL != nil {
+		if err := checkWebhookURL(ctx, *req.URL); err != nil {
+			return nil, err
+		}
+		endpoint.URL = *req.URL
+	}
+	if req.EventTypes != nil {
+		endpoint.EventTypes = dedupe(req.EventTypes)
+	}
+	if req.Active != nil {
+		endpoint.Active = *req.Active
+	}
+	endpoint.UpdatedAt = time.Now()
+
+	if err := s.repo.UpdateEndpoint(ctx, endpoint); err != nil {
+		return nil, err
+	}
+
+	return endpoint, nil
+}
+
+func (s *webhookService) DeleteEndpoint(ctx context.Context, id uuid.UUID) error {
+	if _, err := s.GetEndpoint(ctx, id); err != nil {
+		return err
+	}
+
+	return s.repo.DeleteEndpoint(ctx, id)
+}
+
+func (s *webhookService) ListDeliveries(ctx context.Context, endpointID uuid.UUID, limit int) ([]*models.WebhookDelivery, error) {
+	if _, err := s.GetEndpoint(ctx, endpointID); err != nil {
+		return nil, err
+	}
+	if limit == 0 {
+		limit = models.DefaultDeliveryLimit
+	}
+
+	deliveries, err := s.repo.ListDeliveries(ctx, endpointID, limit)
+	if err != nil {
+		return nil, err
+	}
+	if deliveries == nil {
+		deliveries = []*models.WebhookDelivery{}
+	}
+
+	return deliveries, nil
+}
+
+// Redeliver schedules a delivery for immediate delivery with a fresh set of
+// attempts, whatever its status.
+func (s *webhookService) Redeliver(ctx context.Context, endpointID, deliveryID uuid.UUID) (*models.WebhookDelivery, error) {
+	delivery, err := s.repo.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery == nil || delivery.EndpointID != endpointID {
+		return nil, ErrDeliveryNotFound
+	}
+
+	if err := s.repo.ResetDelivery(ctx, deliveryID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetDelivery(ctx, deliveryID)
+}
+
+// Deliver schedules the delivery of an event to every endpoint of the
+// tenant of ctx that subscribed to its type. Events already scheduled for an
+// endpoint are skipped, so that events can be handed over more than once.
+func (s *webhookService) Deliver(ctx context.Context, event *models.Event) error {
+	_, err := s.deliver(ctx, event)
+	return err
+}
+
+// deliver schedules the deliveries of an event that have not been scheduled
+// yet and returns their number.
+func (s *webhookService) deliver(ctx context.Context, event *models.Event) (int, error) {
+	endpoints, err := s.repo.ListSubscribedEndpoints(ctx, event.Type)
+	if err != nil || len(endpoints) == 0 {
+		return 0, err
+	}
+
+	now := time.Now()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to encode webhook event")
+	}
+
+	scheduled := 0
+	for _, endpoint := range endpoints {
+		delivery := &models.WebhookDelivery{
+			ID:         uuid.New(),
+			EndpointID: endpoint.ID,
+			EventID:    event.ID,
+			EventType:  event.Type,
+			Payload:    payload,
+			Status:     models.DeliveryPending,
+			CreatedAt:  now,
+		}
+		created, err := s.repo.CreateDelivery(ctx, delivery)
+		if err != nil {
+			return scheduled, err
+		}
+		if created {
+			scheduled++
+		}
+	}
+
+	return scheduled, nil
+}
+
+// PublishRenewals announces the charges due within the renewal notice to
+// the endpoints that subscribed to renewal notices. Every charge is
+// announced to an endpoint once. It returns the number of deliveries
+// scheduled. Renewal notices derive from the stored subscriptions rather
+// than from changes, so they bypass the outbox: announcements that are lost
+// are made again by the next scan.
+func (s *webhookService) PublishRenewals(ctx context.Context) (int, error) {
+	tenants, err := s.repo.ListSubscribedTenants(ctx, models.EventSubscriptionRenewing)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	horizon := now.Add(s.renewalNotice)
+	opts := &models.ListOptions{Sort: models.SortByCreatedAt, Order: models.SortAsc}
+
+	published := 0
+	for _, id := range tenants {
+		ctx := tenant.WithID(ctx, id)
+		err := s.subscriptions.Each(ctx, &models.SubscriptionFilter{}, opts, func(sub *models.Subscription) error {
+			present(sub, now)
+			if sub.NextBillingDate == nil || sub.NextBillingDate.After(horizon) {
+				return nil
+			}
+
+			charge := *sub.NextBillingDate
+			scheduled, err := s.deliver(ctx, &models.Event{
+				ID:        uuid.NewSHA1(renewalEventNamespace, []byte(sub.ID.String()+charge.Format("2006-01-02"))),
+				Type:      models.EventSubscriptionRenewing,
+				CreatedAt: now,
+				Data:      models.EventData{Subscription: sub, ChargeDate: &charge},
+			})
+			published += scheduled
+			return err
+		})
+		if err != nil {
+			return published, errors.Wrapf(err, "failed to publish renewals of tenant %s", id)
+		}
+	}
+
+	return published, nil
+}
+
+// DeliverDue attempts the deliveries that are due, of all tenants, and
+// returns the number of attempts.
+func (s *webhookService) DeliverDue(ctx context.Context) (int, error) {
+	// Claims outlast the attempts they are made for.
+	lease := 2 * s.client.Timeout
+	if lease <= 0 {
+		lease = time.Minute
+	}
+
+	due, err := s.repo.ClaimDue(ctx, lease, webhookClaimLimit)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(due))
+	for i, claimed := range due {
+		wg.Add(1)
+		go func(i int, claimed *models.DueWebhookDelivery) {
+			defer wg.Done()
+			attempt := s.attempt(ctx, claimed)
+			errs[i] = s.repo.RecordAttempt(ctx, claimed.Delivery.ID, attempt)
+		}(i, claimed)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return len(due), err
+		}
+	}
+	return len(due), nil
+}
+
+// attempt sends a delivery to its endpoint and decides what happens next.
+// Responses with a 2xx status complete it.
+func (s *webhookService) attempt(ctx context.Context, claimed *models.DueWebhookDelivery) *models.WebhookAttempt {
+	delivery := claimed.Delivery
+	result := &models.WebhookAttempt{}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, claimed.URL, bytes.NewReader(delivery.Payload))
+	if err == nil {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "subscription-service-webhooks")
+		req.Header.Set(WebhookEventHeader, string(delivery.EventType))
+		req.Header.Set(WebhookIDHeader, delivery.EventID.String())
+		req.Header.Set(WebhookDeliveryHeader, delivery.ID.String())
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(claimed.Secret, timestamp, delivery.Payload))
+
+		var resp *http.Response
+		resp, err = s.client.Do(req)
+		if err == nil {
+			defer resp.Body.Close()
+			result.ResponseStatus = resp.StatusCode
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				result.Status = models.DeliverySucceeded
+				return result
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, maxWebhookDrain))
+			err = errors.Errorf("endpoint responded with status %d", resp.StatusCode)
+		}
+	}
+	result.Error = err.Error()
+
+	attempts := delivery.Attempts + 1
+	if attempts >= s.retry.MaxAttempts {
+		result.Status = models.DeliveryFailed
+		return result
+	}
+
+	next := time.Now().Add(s.backoff(attempts))
+	result.Status, result.NextAttemptAt = models.DeliveryPending, &next
+	return result
+}
+
+// backoff returns the wait before the retry following the given number of
+// attempts.
+func (s *webhookService) backoff(attempts int) time.Duration {
+	wait := s.retry.Base
+	for i := 1; i < attempts && wait < s.retry.Max; i++ {
+		wait *= 2
+	}
+	if wait > s.retry.Max {
+		wait = s.retry.Max
+	}
+	return wait
+}
+
+// SignWebhook returns the signature of a webhook payload sent at timestamp,
+// in Unix seconds, as sent in the WebhookSignatureHeader. Receivers verify
+// deliveries by comparing it to the header.
+func SignWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s.", timestamp)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewWebhookClient returns a client for webhook deliveries that bounds
+// every attempt by timeout. It only connects to public addresses, checked
+// when dialing so that hosts resolving to other addresses after their
+// endpoint was registered, and redirects, are refused too. Proxies from the
+// environment are not used, as they would be dialed instead.
+func NewWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialPublic}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !publicAddress(addr) {
+		return errors.Errorf("address %s is not public", host)
+	}
+	return nil
+}
+
+// checkWebhookURL accepts absolute http and https urls whose host resolves
+// to public addresses only.
+func checkWebhookURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Wrap(ErrInvalidWebhook, "url must be an absolute http or https url")
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return errors.Wrapf(ErrInvalidWebhook, "host %s cannot be resolved", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !publicAddress(addr) {
+			return errors.Wrapf(ErrInvalidWebhook, "host %s resolves to %s, which is not a public address", u.Hostname(), addr)
+		}
+	}
+	return nil
+}
+
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// dedupe returns values without repetitions, in their original order.
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"subscription-service/internal/models"
+	"subscription-service/internal/repository"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const testWebhookSecret = "whsec_test"
+
+var testRetry = models.WebhookRetryPolicy{MaxAttempts: 4, Base: time.Minute, Max: 3 * time.Minute}
+
+// fakeWebhookRepository keeps the deliveries of a single endpoint in memory.
+// Pending deliveries are claimed whenever they are asked for, so that retries
+// can be attempted without waiting for them.
+type fakeWebhookRepository struct {
+	repository.WebhookRepository
+
+	url string
+
+	mu         sync.Mutex
+	deliveries map[uuid.UUID]*models.WebhookDelivery
+}
+
+func newFakeWebhookRepository(url string, deliveries ...*models.WebhookDelivery) *fakeWebhookRepository {
+	r := &fakeWebhookRepository{url: url, deliveries: make(map[uuid.UUID]*models.WebhookDelivery)}
+	for _, delivery := range deliveries {
+		r.deliveries[delivery.ID] = delivery
+	}
+	return r
+}
+
+func (r *fakeWebhookRepository) GetDelivery(_ context.Context, id uuid.UUID) (*models.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delivery, ok := r.deliveries[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *delivery
+	return &copied, nil
+}
+
+func (r *fakeWebhookRepository) ResetDelivery(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	delivery := r.deliveries[id]
+	delivery.Status, delivery.Attempts, delivery.NextAttemptAt = models.DeliveryPending, 0, &now
+	return nil
+}
+
+func (r *fakeWebhookRepository) ClaimDue(_ context.Context, _ time.Duration, limit int) ([]*models.DueWebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []*models.DueWebhookDelivery
+	for _, delivery := range r.deliveries {
+		if delivery.Status != models.DeliveryPending || len(due) == limit {
+			continue
+		}
+		copied := *delivery
+		due = append(due, &models.DueWebhookDelivery{Delivery: &copied, TenantID: "tenant", URL: r.url, Secret: testWebhookSecret})
+	}
+	return due, nil
+}
+
+func (r *fakeWebhookRepository) RecordAttempt(_ context.Context, id uuid.UUID, attempt *models.WebhookAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	delivery := r.deliveries[id]
+	delivery.Status = attempt.Status
+	delivery.Attempts++
+	delivery.NextAttemptAt = attempt.NextAttemptAt
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus, delivery.LastError = nil, nil
+	if attempt.ResponseStatus != 0 {
+		delivery.ResponseStatus = &attempt.ResponseStatus
+	}
+	if attempt.Error != "" {
+		delivery.LastError = &attempt.Error
+	}
+	return nil
+}
+
+func newTestDelivery(t *testing.T) *models.WebhookDelivery {
+	t.Helper()
+
+	payload, err := json.Marshal(map[string]string{"type": string(models.EventSubscriptionCreated)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	return &models.WebhookDelivery{
+		ID:            uuid.New(),
+		EndpointID:    uuid.New(),
+		EventID:       uuid.New(),
+		EventType:     models.EventSubscriptionCreated,
+		Payload:       payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+	}
+}
+
+func newTestWebhookService(repo repository.WebhookRepository, client *http.Client) *webhookService {
+	return NewWebhookService(repo, nil, client, testRetry, time.Hour).(*webhookService)
+}
+
+func TestDeliverDueSignsPayloads(t *testing.T) {
+	delivery := newTestDelivery(t)
+
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{header: r.Header.Clone(), body: body}
+	}))
+	defer server.Close()
+
+	repo := newFakeWebhookRepository(server.URL, delivery)
+	s := newTestWebhookService(repo, &http.Client{Timeout: 5 * time.Second})
+
+	if n, err := s.DeliverDue(context.Background()); err != nil || n != 1 {
+		t.Fatalf("DeliverDue() = %d, %v, want 1 attempt", n, err)
+	}
+
+	req := <-requests
+	timestamp := req.header.Get(WebhookTimestampHeader)
+	if timestamp == "" {
+		t.Fatalf("missing %s header", WebhookTimestampHeader)
+	}
+	if got, want := req.header.Get(WebhookSignatureHeader), SignWebhook(testWebhookSecret, timestamp, req.body); got != want {
+		t.Errorf("%s = %q, want %q", WebhookSignatureHeader, got, want)
+	}
+	if string(req.body) != string(delivery.Payload) {
+		t.Errorf("body = %s, want %s", req.body, delivery.Payload)
+	}
+	if got := req.header.Get(WebhookDeliveryHeader); got != delivery.ID.String() {
+		t.Errorf("%s = %q, want %q", WebhookDeliveryHeader, got, delivery.ID)
+	}
+
+	got, _ := repo.GetDelivery(context.Background(), delivery.ID)
+	if got.Status != models.DeliverySucceeded || got.Attempts != 1 {
+		t.Errorf("delivery = %s after %d attempts, want %s after 1", got.Status, got.Attempts, models.DeliverySucceeded)
+	}
+}
+
+func TestDeliverDueRetriesFailures(t *testing.T) {
+	delivery := newTestDelivery(t)
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "internal details of the endpoint", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	repo := newFakeWebhookRepository(server.URL, delivery)
+	s := newTestWebhookService(repo, &http.Client{Timeout: 5 * time.Second})
+	ctx := context.Background()
+
+	for attempt := 1; attempt < testRetry.MaxAttempts; attempt++ {
+		before := time.Now()
+		if _, err := s.DeliverDue(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		got, _ := repo.GetDelivery(ctx, delivery.ID)
+		if got.Status != models.DeliveryPending || got.Attempts != attempt {
+			t.Fatalf("delivery = %s after %d attempts, want %s after %d", got.Status, got.Attempts, models.DeliveryPending, attempt)
+		}
+		wait := s.backoff(attempt)
+		if got.NextAttemptAt == nil || got.NextAttemptAt.Before(before.Add(wait)) || got.NextAttemptAt.After(time.Now().Add(wait)) {
+			t.Errorf("attempt %d: next attempt at %v, want in %v", attempt, got.NextAttemptAt, wait)
+		}
+		if got.ResponseStatus == nil || *got.ResponseStatus != http.StatusInternalServerError {
+			t.Errorf("attempt %d: response status = %v, want %d", attempt, got.ResponseStatus, http.StatusInternalServerError)
+		}
+		if got.LastError == nil || *got.LastError != "endpoint responded with status 500" {
+			t.Errorf("attempt %d: last error = %v, want the status only", attempt, got.LastError)
+		}
+	}
+
+	if _, err := s.DeliverDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := repo.GetDelivery(ctx, delivery.ID)
+	if got.Status != models.DeliveryFailed || got.Attempts != testRetry.MaxAttempts || got.NextAttemptAt != nil {
+		t.Errorf("delivery = %s after %d attempts, want %s after %d", got.Status, got.Attempts, models.DeliveryFailed, testRetry.MaxAttempts)
+	}
+
+	// Failed deliveries are not claimed again.
+	if n, err := s.DeliverDue(ctx); err != nil || n != 0 {
+		t.Errorf("DeliverDue() = %d, %v, want no attempts", n, err)
+	}
+	if n := int(calls.Load()); n != testRetry.MaxAttempts {
+		t.Errorf("endpoint called %d times, want %d", n, testRetry.MaxAttempts)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	s := newTestWebhookService(nil, nil)
+	want := []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute}
+	for i, wait := range want {
+		if got := s.backoff(i + 1); got != wait {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, wait)
+		}
+	}
+}
+
+func TestRedeliverResetsFailedDelivery(t *testing.T) {
+	delivery := newTestDelivery(t)
+	delivery.Status, delivery.Attempts, delivery.NextAttemptAt = models.DeliveryFailed, testRetry.MaxAttempts, nil
+
+	repo := newFakeWebhookRepository("", delivery)
+	s := newTestWebhookService(repo, nil)
+	ctx := context.Background()
+
+	if _, err := s.Redeliver(ctx, uuid.New(), delivery.ID); errors.Cause(err) != ErrDeliveryNotFound {
+		t.Errorf("Redeliver() to another endpoint = %v, want %v", err, ErrDeliveryNotFound)
+	}
+
+	before := time.Now()
+	got, err := s.Redeliver(ctx, delivery.EndpointID, delivery.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.DeliveryPending || got.Attempts != 0 {
+		t.Errorf("delivery = %s after %d attempts, want %s after 0", got.Status, got.Attempts, models.DeliveryPending)
+	}
+	if got.NextAttemptAt == nil || got.NextAttemptAt.Before(before) {
+		t.Errorf("next attempt at %v, want now", got.NextAttemptAt)
+	}
+}
+
+func TestWebhookClientRefusesNonPublicAddresses(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer server.Close()
+
+	delivery := newTestDelivery(t)
+	repo := newFakeWebhookRepository(server.URL, delivery)
+	s := newTestWebhookService(repo, NewWebhookClient(5*time.Second))
+
+	if _, err := s.DeliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 0 {
+		t.Error("endpoint on a loopback address was called")
+	}
+	got, _ := repo.GetDelivery(context.Background(), delivery.ID)
+	if got.Status != models.DeliveryPending || got.ResponseStatus != nil || got.LastError == nil {
+		t.Errorf("delivery = %s with status %v and error %v, want a pending retry after a dial error", got.Status, got.ResponseStatus, got.LastError)
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34":          true,
+		"2606:2800:220:1::":      true,
+		"127.0.0.1":              false,
+		"::1":                    false,
+		"10.1.2.3":               false,
+		"172.16.0.1":             false,
+		"192.168.1.1":            false,
+		"169.254.169.254":        false,
+		"fe80::1":                false,
+		"fd00::1":                false,
+		"0.0.0.0":                false,
+		"100.64.0.1":             false,
+		"::ffff:169.254.169.254": false,
+		"64:ff9b::a9fe:a9fe":     false,
+		"224.0.0.1":              false,
+	}
+	for raw, want := range tests {
+		if got := publicAddress(netip.MustParseAddr(raw)); got != want {
+			t.Errorf("publicAddress(%s) = %v, want %v", raw, got, want)
+		}
+	}
+}
+
+func TestCheckWebhookURL(t *testing.T) {
+	for _, raw := range []string{
+		"ftp://example.com/hook",
+		"/hook",
+		"http://127.0.0.1:8080/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://localhost/hook",
+	} {
+		if err := checkWebhookURL(context.Background(), raw); errors.Cause(err) != ErrInvalidWebhook {
+			t.Errorf("checkWebhookURL(%q) = %v, want %v", raw, err, ErrInvalidWebhook)
+		}
+	}
+
+	if err := checkWebhookURL(context.Background(), "https://93.184.216.34/hook"); err != nil {
+		t.Errorf("checkWebhookURL() of a public address = %v", err)
+	}
+}
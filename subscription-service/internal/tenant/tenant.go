@@ -0,0 +1,39 @@
+package tenant
+
+import (
+	"context"
+	"regexp"
+)
+
+// Default is the tenant of requests that do not name one and of all data
+// that existed before tenants were introduced.
+const Default = "default"
+
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+type tenantKey struct{}
+
+// WithID returns a context carrying the tenant id.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// ID returns the tenant carried by ctx, if any.
+func ID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(tenantKey{}).(string)
+	return id, ok
+}
+
+// FromContext returns the tenant carried by ctx, falling back to Default.
+func FromContext(ctx context.Context) string {
+	if id, ok := ID(ctx); ok {
+		return id
+	}
+	return Default
+}
+
+// Valid reports whether id is a well-formed tenant id: lower case letters,
+// digits, dashes and underscores, at most 63 characters.
+func Valid(id string) bool {
+	return idPattern.MatchString(id)
+}
@@ -2,25 +2,34 @@ package database
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"log"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
-func NewConnection(host, port, user, password, dbname, sslmode string) (*sql.DB, error) {
+// NewConnection connects to PostgreSQL. Connections are made through the
+// connector returned by wrap when it is not nil.
+func NewConnection(host, port, user, password, dbname, sslmode string, wrap func(driver.Connector) driver.Connector) (*sql.DB, error) {
 	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		host, port, user, password, dbname, sslmode)
 
-	db, err := sql.Open("postgres", connStr)
+	pqConnector, err := pq.NewConnector(connStr)
 	if err != nil {
 		return nil, err
 	}
+	var connector driver.Connector = pqConnector
+	if wrap != nil {
+		connector = wrap(connector)
+	}
+	db := sql.OpenDB(connector)
 
 	if err = db.Ping(); err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	log.Println("Successfully connected to database")
+	log.Printf("Successfully connected to database as %s", user)
 	return db, nil
 }
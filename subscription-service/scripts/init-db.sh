@@ -0,0 +1,15 @@
+#!/bin/sh
+# Initializes the database of docker-compose.yml: applies the migrations and
+# sets the passwords of the roles the service connects as.
+set -e
+
+for migration in /migrations/*.sql; do
+    echo "Applying $migration"
+    psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "$POSTGRES_DB" -f "$migration"
+done
+
+psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "$POSTGRES_DB" \
+    -v app_password="$APP_DB_PASSWORD" -v jobs_password="$JOBS_DB_PASSWORD" <<'SQL'
+ALTER ROLE subscription_app PASSWORD :'app_password';
+ALTER ROLE subscription_jobs PASSWORD :'jobs_password';
+SQL